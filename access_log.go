@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	AccessLogFormatCLF  = "clf"
+	AccessLogFormatJSON = "json"
+)
+
+// accessLogWriter writes one line per request to the access log file.
+type accessLogWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format string
+}
+
+// openAccessLog opens the access log file for appending. It returns nil when
+// no file is configured.
+func openAccessLog(path string, format string) (*accessLogWriter, error) {
+	if path == "" {
+		return nil, nil
+	}
+	switch format {
+	case "", AccessLogFormatCLF:
+		format = AccessLogFormatCLF
+	case AccessLogFormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid access log format %q, expected %s or %s", format, AccessLogFormatCLF, AccessLogFormatJSON)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &accessLogWriter{out: f, format: format}, nil
+}
+
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs float64   `json:"durationMs"`
+	Injected   bool      `json:"injected"`
+	UserAgent  string    `json:"userAgent"`
+}
+
+// Close closes the access log file once the server no longer handles
+// requests.
+func (l *accessLogWriter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.out.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (l *accessLogWriter) Write(entry accessLogEntry) {
+	var line []byte
+	if l.format == AccessLogFormatJSON {
+		line, _ = json.Marshal(entry)
+		line = append(line, '\n')
+	} else {
+		host, _, err := net.SplitHostPort(entry.RemoteAddr)
+		if err != nil {
+			host = entry.RemoteAddr
+		}
+		size := "-"
+		if entry.Bytes > 0 {
+			size = fmt.Sprintf("%d", entry.Bytes)
+		}
+		line = []byte(fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s\n",
+			host, entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			entry.Method, entry.Path, entry.Proto, entry.Status, size,
+		))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line)
+}
+
+// accessLogHandler records every request passed to next: it counts it, adds it
+// to the request history and the event log and writes it to the access log
+// file, if any. Requests of dotdev's own endpoints are not recorded.
+func accessLogHandler(accessLog *accessLogWriter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isInternalPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := newResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+		duration := time.Since(start)
+
+		entry := accessLogEntry{
+			Time:       start,
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Proto:      r.Proto,
+			Status:     rec.Status(),
+			Bytes:      rec.bytes,
+			DurationMs: float64(duration.Microseconds()) / 1000,
+			Injected:   rec.injected,
+			UserAgent:  r.UserAgent(),
+		}
+		recentRequests.Add(RequestRecord{
+			Time:     start,
+			Method:   entry.Method,
+			Path:     entry.Path,
+			Status:   entry.Status,
+			Bytes:    entry.Bytes,
+			Duration: duration,
+			Injected: entry.Injected,
+		})
+		if accessLog != nil {
+			accessLog.Write(entry)
+		}
+
+		message := fmt.Sprintf("%s %s %d %dB %s", entry.Method, entry.Path, entry.Status, entry.Bytes, duration.Round(10*time.Microsecond))
+		if entry.Injected {
+			message += " (live reload injected)"
+		}
+		ServerState.IncRequests()
+		ServerState.RecordEvent("request", message,
+			slog.String("method", entry.Method),
+			slog.String("path", entry.Path),
+			slog.Int("status", entry.Status),
+			slog.Int64("bytes", entry.Bytes),
+			slog.Float64("durationMs", entry.DurationMs),
+			slog.Bool("injected", entry.Injected),
+		)
+	})
+}
+
+// markInjected flags the response as carrying the live reload snippet for the
+// access log.
+func markInjected(w http.ResponseWriter) {
+	for {
+		if rec, ok := w.(*responseRecorder); ok {
+			rec.injected = true
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// eventStatus returns the HTTP status of a request event, or 0 for other events.
+func eventStatus(e Event) int {
+	if e.Kind != "request" {
+		return 0
+	}
+	for _, attr := range e.Attrs {
+		if attr.Key == "status" {
+			return int(attr.Value.Int64())
+		}
+	}
+	return 0
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAccessLog verifies that requests are written to the access log file with
+// their status, and that responses with the live reload snippet are marked.
+func TestAccessLog(t *testing.T) {
+	tmpDir := t.TempDir()
+	htmlPath := filepath.Join(tmpDir, "index.html")
+	os.WriteFile(htmlPath, []byte(`<html><body>Hello</body></html>`), 0644)
+	logPath := filepath.Join(tmpDir, "access.json")
+
+	accessLog, err := openAccessLog(logPath, AccessLogFormatJSON)
+	if err != nil {
+		t.Fatalf("Failed to open access log: %v", err)
+	}
+	ts := httptest.NewServer(newDevServer(htmlPath, Config{}, accessLog))
+	defer ts.Close()
+
+	for _, path := range []string{"/", "/missing-asset.css", "/__dotdev/status"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+	if err := accessLog.Close(); err != nil {
+		t.Fatalf("Failed to close access log: %v", err)
+	}
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read access log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 access log lines, got %d: %s", len(lines), content)
+	}
+	var entries []accessLogEntry
+	for _, line := range lines {
+		var entry accessLogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to decode access log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if entries[0].Path != "/" || entries[0].Status != http.StatusOK || !entries[0].Injected || entries[0].Bytes == 0 {
+		t.Fatalf("Unexpected entry for /: %+v", entries[0])
+	}
+	if entries[1].Path != "/missing-asset.css" || entries[1].Status != http.StatusNotFound || entries[1].Injected {
+		t.Fatalf("Unexpected entry for /missing-asset.css: %+v", entries[1])
+	}
+}
+
+// TestAccessLogCLF verifies the Common Log Format line.
+func TestAccessLogCLF(t *testing.T) {
+	var b strings.Builder
+	l := &accessLogWriter{out: &b, format: AccessLogFormatCLF}
+	l.Write(accessLogEntry{
+		RemoteAddr: "127.0.0.1:5000",
+		Method:     "GET",
+		Path:       "/app.js?v=1",
+		Proto:      "HTTP/1.1",
+		Status:     404,
+	})
+	want := `127.0.0.1 - - [01/Jan/0001:00:00:00 +0000] "GET /app.js?v=1 HTTP/1.1" 404 -` + "\n"
+	if b.String() != want {
+		t.Fatalf("Expected %q, got %q", want, b.String())
+	}
+}
+
+// TestOpenAccessLogErrors verifies that an access log that cannot be written
+// is reported instead of being ignored.
+func TestOpenAccessLogErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := openAccessLog(filepath.Join(dir, "access.log"), "xml"); err == nil || !strings.Contains(err.Error(), `invalid access log format "xml"`) {
+		t.Fatalf("Expected an error for an unknown format, got %v", err)
+	}
+	if _, err := openAccessLog(filepath.Join(dir, "missing", "access.log"), AccessLogFormatCLF); err == nil {
+		t.Fatalf("Expected an error for a file in a missing directory")
+	}
+	if l, err := openAccessLog("", AccessLogFormatCLF); l != nil || err != nil {
+		t.Fatalf("Expected no access log without a file, got %v, %v", l, err)
+	}
+}
@@ -1,50 +1,94 @@
-function fetchAndReload() {
-    console.log("[dotdev] Fetching updated content", location.href, "...");
-    fetch(location.href)
-        .then(response => response.text())
-        .then(html => {
-            var parser = new DOMParser();
-            var doc = parser.parseFromString(html, 'text/html');
-            document.head.innerHTML = doc.head.innerHTML;
-            document.body.innerHTML = doc.body.innerHTML;
-        })
-        .catch(err => {
-            console.error("[dotdev] Hot update failed:", err);
-        });
-}
-
-function connectWs() {
-    var ws = new WebSocket("ws://" + location.host + "/ws");
-
-    ws.onopen = () => {
-        console.log("[dotdev] WebSocket connected");
-        fetchAndReload();
-    };
-
-    ws.onmessage = msg => {
-        if (msg.data === "refresh") {
-            location.reload();
-        }
-        if (msg.data === "reload") {
-            console.log("[dotdev] Hot updating app content ...");
+(function () {
+    var warnings = [];
+
+    function fetchAndReload() {
+        console.log("[dotdev] Fetching updated content", location.href, "...");
+        fetch(location.href)
+            .then(response => response.text())
+            .then(html => {
+                var parser = new DOMParser();
+                var doc = parser.parseFromString(html, 'text/html');
+                document.head.innerHTML = doc.head.innerHTML;
+                document.body.innerHTML = doc.body.innerHTML;
+                showWarnings();
+            })
+            .catch(err => {
+                console.error("[dotdev] Hot update failed:", err);
+            });
+    }
+
+    function connectWs() {
+        var ws = new WebSocket("ws://" + location.host + "/ws?page=" + encodeURIComponent(location.pathname + location.search));
+
+        ws.onopen = () => {
+            console.log("[dotdev] WebSocket connected");
             fetchAndReload();
-        }
-    };
+        };
 
-    ws.onclose = () => {
-        console.log("[dotdev] WebSocket disconnected, reconnecting in 1s...");
-        setTimeout(connectWs, 1000);
-    };
+        ws.onmessage = msg => {
+            if (msg.data === "refresh") {
+                location.reload();
+            }
+            if (msg.data === "reload") {
+                console.log("[dotdev] Hot updating app content ...");
+                fetchAndReload();
+            }
+            if (msg.data.startsWith("warnings ")) {
+                warnings = JSON.parse(msg.data.slice("warnings ".length));
+                warnings.forEach(warning => console.warn("[dotdev]", warning));
+                showWarnings();
+            }
+        };
 
-    ws.onerror = err => {
-        console.error("[dotdev] WebSocket encountered error: ", err);
-        ws.close();
-    };
-}
+        ws.onclose = event => {
+            if (event.code === 1001 && event.reason === "server shutting down") {
+                console.log("[dotdev] Server stopped");
+                showStopped();
+                return;
+            }
+            console.log("[dotdev] WebSocket disconnected, reconnecting in 1s...");
+            setTimeout(connectWs, 1000);
+        };
+
+        ws.onerror = () => {
+            ws.close();
+        };
+    }
+
+    function showStopped() {
+        var indicator = document.createElement("div");
+        indicator.id = "dotdev-stopped";
+        indicator.textContent = "dotdev stopped";
+        indicator.title = "The dev server was stopped. Reload the page after restarting it.";
+        indicator.style.cssText = "position:fixed;right:1rem;bottom:1rem;z-index:2147483647;" +
+            "padding:0.4rem 0.8rem;border-radius:4px;background:#222;color:#eee;" +
+            "font:14px/1.4 Arial,sans-serif;box-shadow:0 2px 8px rgba(0,0,0,0.3);";
+        document.body.appendChild(indicator);
+    }
+
+    function showWarnings() {
+        var panel = document.getElementById("dotdev-warnings");
+        if (panel) {
+            panel.remove();
+        }
+        if (warnings.length === 0) {
+            return;
+        }
+        panel = document.createElement("div");
+        panel.id = "dotdev-warnings";
+        panel.title = "Click to dismiss";
+        panel.style.cssText = "position:fixed;left:1rem;bottom:1rem;z-index:2147483647;max-width:calc(100% - 2rem);" +
+            "padding:0.4rem 0.8rem;border-radius:4px;background:#fff3cd;color:#664d03;cursor:pointer;" +
+            "font:13px/1.4 monospace;white-space:pre-wrap;box-shadow:0 2px 8px rgba(0,0,0,0.3);";
+        panel.textContent = "dotdev: broken references\n" + warnings.join("\n");
+        panel.onclick = () => panel.remove();
+        document.body.appendChild(panel);
+    }
 
-function main() {
-    console.log("[dotdev] Version {{dotdev::version}}");
-    connectWs();
-}
+    function main() {
+        console.log("[dotdev] Version {{dotdev::version}}");
+        connectWs();
+    }
 
-main()
+    main();
+})();
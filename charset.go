@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+
+	reMetaTag      = regexp.MustCompile(`(?i)<meta\b[^>]*>`)
+	reCharsetLabel = regexp.MustCompile(`^\s*([a-zA-Z0-9_\-:.]+)`)
+	// reContentCharset matches the charset parameter of a Content-Type value.
+	reContentCharset = regexp.MustCompile(`(?i)\bcharset\s*=\s*["']?\s*([a-zA-Z0-9_\-:.]+)`)
+)
+
+// charsetPrescanLimit is the number of bytes searched for a <meta> charset
+// declaration, as in the HTML encoding sniffing algorithm.
+const charsetPrescanLimit = 1024
+
+// detectCharset determines the encoding of an HTML document from its byte
+// order mark, a <meta charset> or a <meta http-equiv="Content-Type"> declaration.
+// It returns a lowercase charset label, or an empty string when the document
+// declares nothing and is not valid UTF-8.
+func detectCharset(content []byte) string {
+	switch {
+	case bytes.HasPrefix(content, bomUTF8):
+		return "utf-8"
+	case bytes.HasPrefix(content, bomUTF16LE):
+		return "utf-16le"
+	case bytes.HasPrefix(content, bomUTF16BE):
+		return "utf-16be"
+	}
+
+	head := content
+	if len(head) > charsetPrescanLimit {
+		head = head[:charsetPrescanLimit]
+	}
+	for _, tag := range reMetaTag.FindAllString(string(head), -1) {
+		charset := metaCharset(tag)
+		if charset == "" {
+			continue
+		}
+		// A document read as ASCII-compatible bytes cannot be UTF-16, browsers
+		// treat such a declaration as UTF-8.
+		if strings.HasPrefix(charset, "utf-16") {
+			return "utf-8"
+		}
+		return charset
+	}
+	if utf8.Valid(content) {
+		return "utf-8"
+	}
+	return ""
+}
+
+// metaCharset returns the lowercase charset a <meta> tag declares, with a
+// charset attribute or as the content of http-equiv="Content-Type". Other
+// attributes mentioning a charset, such as a description, declare nothing.
+func metaCharset(tag string) string {
+	var m []string
+	if value, ok := tagAttribute(tag, "charset"); ok {
+		m = reCharsetLabel.FindStringSubmatch(value)
+	} else if equiv, _ := tagAttribute(tag, "http-equiv"); strings.EqualFold(strings.TrimSpace(equiv), "content-type") {
+		content, _ := tagAttribute(tag, "content")
+		m = reContentCharset.FindStringSubmatch(content)
+	}
+	if m == nil {
+		return ""
+	}
+	return strings.ToLower(m[1])
+}
+
+// htmlContentType returns the Content-Type header value for an HTML document
+// in the given charset.
+func htmlContentType(charset string) string {
+	if charset == "" {
+		return "text/html"
+	}
+	return fmt.Sprintf("text/html; charset=%s", charset)
+}
+
+// injectSnippet inserts snippet before the closing </body> tag of the document,
+// or appends it when there is none. The snippet is encoded to match the
+// document encoding, so legacy and UTF-16 documents stay intact. It returns the
+// new document together with its detected charset.
+func injectSnippet(content []byte, snippet string) ([]byte, string) {
+	charset := detectCharset(content)
+	switch charset {
+	case "utf-16le", "utf-16be":
+		return injectSnippetUTF16(content, snippet, charset == "utf-16be"), charset
+	}
+
+	// Every ASCII-compatible encoding shares the byte values of the ASCII
+	// range, so an ASCII-only snippet can be spliced in as is.
+	encoded := []byte("\n" + asciiSnippet(snippet) + "\n")
+	idx := lastIndexFoldASCII(content, []byte("</body>"))
+	if idx == -1 {
+		return append(content, encoded[1:len(encoded)-1]...), charset
+	}
+	result := make([]byte, 0, len(content)+len(encoded))
+	result = append(result, content[:idx]...)
+	result = append(result, encoded...)
+	result = append(result, content[idx:]...)
+	return result, charset
+}
+
+// injectSnippetUTF16 decodes a UTF-16 document with a byte order mark, injects
+// snippet and encodes it back in the original byte order.
+func injectSnippetUTF16(content []byte, snippet string, bigEndian bool) []byte {
+	body := content[2:]
+	units := make([]uint16, len(body)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(body[2*i])<<8 | uint16(body[2*i+1])
+		} else {
+			units[i] = uint16(body[2*i+1])<<8 | uint16(body[2*i])
+		}
+	}
+	document := string(utf16.Decode(units))
+	if idx := lastIndexFoldASCII([]byte(document), []byte("</body>")); idx != -1 {
+		document = document[:idx] + "\n" + snippet + "\n" + document[idx:]
+	} else {
+		document += snippet
+	}
+
+	encoded := utf16.Encode([]rune(document))
+	result := make([]byte, 2, 2+2*len(encoded))
+	copy(result, content[:2])
+	for _, u := range encoded {
+		if bigEndian {
+			result = append(result, byte(u>>8), byte(u))
+		} else {
+			result = append(result, byte(u), byte(u>>8))
+		}
+	}
+	return result
+}
+
+// asciiSnippet escapes non-ASCII characters of a script snippet as JavaScript
+// unicode escapes, so it is valid in any ASCII-compatible encoding.
+func asciiSnippet(snippet string) string {
+	var b strings.Builder
+	for _, r := range snippet {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+			continue
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&b, "\\u%04x", u)
+		}
+	}
+	return b.String()
+}
+
+// lastIndexFoldASCII is like bytes.LastIndex but ignores the case of ASCII
+// letters. Unlike bytes.ToLower, it never changes the length of the input
+// when it is not valid UTF-8.
+func lastIndexFoldASCII(s, sep []byte) int {
+	for i := len(s) - len(sep); i >= 0; i-- {
+		match := true
+		for j := range sep {
+			if lowerASCII(s[i+j]) != lowerASCII(sep[j]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// TestDetectCharset verifies detection from byte order marks and <meta> declarations.
+func TestDetectCharset(t *testing.T) {
+	cases := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"utf-8 bom", append([]byte{0xEF, 0xBB, 0xBF}, "<html></html>"...), "utf-8"},
+		{"utf-16le bom", []byte{0xFF, 0xFE, '<', 0}, "utf-16le"},
+		{"utf-16be bom", []byte{0xFE, 0xFF, 0, '<'}, "utf-16be"},
+		{"meta charset", []byte(`<html><head><meta charset="windows-1250"></head></html>`), "windows-1250"},
+		{"meta charset unquoted", []byte(`<meta charset=Shift_JIS>`), "shift_jis"},
+		{"http-equiv", []byte(`<meta http-equiv="Content-Type" content="text/html; charset=ISO-8859-2">`), "iso-8859-2"},
+		{"http-equiv after content", []byte(`<meta content="text/html; charset=koi8-r" http-equiv=content-type>`), "koi8-r"},
+		{"charset in another attribute", []byte(`<meta name="description" content="Set charset=latin1 in the header"><meta charset="windows-1252">`), "windows-1252"},
+		{"content without http-equiv", []byte(`<meta name="x" content="text/html; charset=iso-8859-2"><p>ž</p>`), "utf-8"},
+		{"utf-16 declared without bom", []byte(`<meta charset="utf-16">`), "utf-8"},
+		{"undeclared utf-8", []byte("<p>Příliš žluťoučký kůň</p>"), "utf-8"},
+		{"undeclared legacy", []byte{'<', 'p', '>', 0xE8, '<', '/', 'p', '>'}, ""},
+	}
+	for _, c := range cases {
+		if got := detectCharset(c.content); got != c.want {
+			t.Errorf("%s: expected charset %q, got %q", c.name, c.want, got)
+		}
+	}
+}
+
+// TestInjectSnippetLegacyEncoding verifies that non-UTF-8 bytes are preserved and the
+// snippet is escaped to ASCII.
+func TestInjectSnippetLegacyEncoding(t *testing.T) {
+	// "Žluť" in windows-1250.
+	content := []byte("<html><head><meta charset=\"windows-1250\"></head><BODY>\x8Elu\x9D</BODY></html>")
+	result, charset := injectSnippet(content, "<script>console.log('ü')</script>")
+	if charset != "windows-1250" {
+		t.Fatalf("Expected windows-1250 charset, got %q", charset)
+	}
+	want := "<html><head><meta charset=\"windows-1250\"></head><BODY>\x8Elu\x9D\n<script>console.log('\\u00fc')</script>\n</BODY></html>"
+	if string(result) != want {
+		t.Fatalf("Unexpected injection result: %q", result)
+	}
+}
+
+// TestInjectSnippetUTF16 verifies that UTF-16 documents receive a UTF-16 encoded snippet.
+func TestInjectSnippetUTF16(t *testing.T) {
+	content := encodeUTF16LE("<html><body>Hello</body></html>")
+	result, charset := injectSnippet(content, "<script></script>")
+	if charset != "utf-16le" {
+		t.Fatalf("Expected utf-16le charset, got %q", charset)
+	}
+	want := encodeUTF16LE("<html><body>Hello\n<script></script>\n</body></html>")
+	if !bytes.Equal(result, want) {
+		t.Fatalf("Unexpected injection result: %q", result)
+	}
+}
+
+// TestIndexContentType verifies that the served index declares the document charset.
+func TestIndexContentType(t *testing.T) {
+	tmpDir := t.TempDir()
+	htmlPath := filepath.Join(tmpDir, "index.html")
+	os.WriteFile(htmlPath, []byte("<html><head><meta charset=\"shift_jis\"></head><body>\x82\xA0</body></html>"), 0644)
+
+	rec := httptest.NewRecorder()
+	indexHandler(htmlPath, Config{})(rec, httptest.NewRequest("GET", "/", nil), htmlPath, nil)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=shift_jis" {
+		t.Fatalf("Expected shift_jis Content-Type, got %q", ct)
+	}
+	if !bytes.Contains(rec.Body.Bytes(), []byte("\x82\xA0")) {
+		t.Fatalf("Expected Shift_JIS bytes to be preserved, got %q", rec.Body.Bytes())
+	}
+}
+
+func encodeUTF16LE(s string) []byte {
+	result := []byte{0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(s)) {
+		result = append(result, byte(u), byte(u>>8))
+	}
+	return result
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// htmlReference is a URL referenced by an attribute of an HTML document.
+type htmlReference struct {
+	Line int
+	Tag  string
+	Attr string
+	URL  string
+}
+
+// element names the tag and attribute of the reference, e.g. <img src>.
+func (r htmlReference) element() string {
+	return "<" + r.Tag + " " + r.Attr + ">"
+}
+
+// pageLinkTags are the elements linking to other pages. With --spa, links to
+// routes without a file are served by the entry file and are not broken.
+var pageLinkTags = map[string]bool{"a": true, "area": true}
+
+// scanHTMLReferences returns the URLs referenced by the scripts, stylesheets,
+// icons, media, frames and links of a document, including <base href>.
+// Inline scripts and styles are skipped.
+func scanHTMLReferences(content []byte) []htmlReference {
+	var refs []htmlReference
+	for _, loc := range reExportToken.FindAllIndex(content, -1) {
+		token := string(content[loc[0]:loc[1]])
+		if strings.HasPrefix(token, "<!--") {
+			continue
+		}
+		if parts := reElement.FindStringSubmatch(token); parts != nil {
+			token = parts[1]
+		}
+		tag := strings.ToLower(reTagName.FindStringSubmatch(token)[1])
+		line := lineAt(content, int64(loc[0]))
+		add := func(attr string, value string) {
+			refs = append(refs, htmlReference{Line: line, Tag: tag, Attr: attr, URL: value})
+		}
+		editAttributes(token, func(attr string, value string) (string, bool) {
+			switch {
+			case attr == "href" && (tag == "base" || tag == "a" || tag == "area"):
+				add(attr, value)
+			case attr == "href" && tag == "link":
+				rel, _ := tagAttribute(token, "rel")
+				rel = strings.ToLower(rel)
+				if !strings.Contains(rel, "preconnect") && !strings.Contains(rel, "dns-prefetch") {
+					add(attr, value)
+				}
+			case attr == "src":
+				add(attr, value)
+			case attr == "poster" || (attr == "data" && tag == "object"):
+				add(attr, value)
+			case attr == "srcset":
+				for _, candidate := range parseSrcset(value) {
+					add(attr, candidate.URL)
+				}
+			}
+			return value, true
+		})
+	}
+	return refs
+}
+
+// brokenReference is a reference to a missing file or fragment.
+type brokenReference struct {
+	File    string
+	Line    int
+	Element string
+	URL     string
+	Problem string
+}
+
+func (b brokenReference) String() string {
+	return fmt.Sprintf("%s:%d: %s %q %s", b.File, b.Line, b.Element, b.URL, b.Problem)
+}
+
+// referenceChecker finds the references of documents that do not resolve to
+// a file, or to an element for a #fragment. URLs are resolved like the dev
+// server serves them, from the root directory and the mounts.
+type referenceChecker struct {
+	root   string
+	mounts []Mount
+	// index is the file served at /, if not the index.html of the root.
+	index string
+	spa   bool
+	// template checks pages rendered as templates, as with --template.
+	template bool
+
+	ids map[string]map[string]bool
+}
+
+func newReferenceChecker(root string, mounts []Mount, spa bool) *referenceChecker {
+	return &referenceChecker{root: root, mounts: mounts, spa: spa, ids: map[string]map[string]bool{}}
+}
+
+// checkFile checks the references of a document under the root, after its
+// includes are expanded and, with template, it is rendered, so line numbers
+// refer to the page as served. It returns the broken ones and the number of
+// local references checked.
+func (c *referenceChecker) checkFile(file string) ([]brokenReference, int, error) {
+	content, err := c.readPage(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	base := documentURL(c.root, c.mounts, file)
+	c.ids[file] = documentIDs(content)
+
+	var broken []brokenReference
+	checked := 0
+	for _, ref := range scanHTMLReferences(content) {
+		target, err := base.Parse(strings.TrimSpace(ref.URL))
+		if ref.Tag == "base" {
+			if err == nil {
+				base = target
+			}
+			continue
+		}
+		if err != nil {
+			broken = append(broken, brokenReference{file, ref.Line, ref.element(), ref.URL, "is not a valid URL"})
+			continue
+		}
+		if target.Scheme != "" || target.Host != "" || ref.URL == "" {
+			continue
+		}
+		checked++
+		if problem := c.checkTarget(file, target, pageLinkTags[ref.Tag]); problem != "" {
+			broken = append(broken, brokenReference{file, ref.Line, ref.element(), ref.URL, problem})
+		}
+	}
+	return broken, checked, nil
+}
+
+// checkTarget returns the problem with a local URL referenced from file, or
+// an empty string when it resolves.
+func (c *referenceChecker) checkTarget(file string, target *url.URL, pageLink bool) string {
+	targetFile := resolveURLPath(c.root, c.mounts, target.Path)
+	if target.Path == "/" && c.index != "" {
+		targetFile = c.index
+	}
+	info, err := os.Stat(targetFile)
+	if err == nil && info.IsDir() {
+		index := filepath.Join(targetFile, "index.html")
+		if _, err := os.Stat(index); err != nil {
+			// The directory is listed by the file server.
+			return ""
+		}
+		targetFile = index
+	} else if err != nil {
+		if c.spa && pageLink && path.Ext(target.Path) == "" {
+			return ""
+		}
+		return "not found"
+	}
+
+	fragment := target.Fragment
+	if fragment == "" || fragment == "top" || !isHTMLFile(targetFile) {
+		return ""
+	}
+	if filepath.Clean(targetFile) == filepath.Clean(file) {
+		targetFile = file
+	}
+	ids, ok := c.ids[targetFile]
+	if !ok {
+		content, err := c.readPage(targetFile)
+		if err != nil {
+			return ""
+		}
+		ids = documentIDs(content)
+		c.ids[targetFile] = ids
+	}
+	if !ids[fragment] {
+		return fmt.Sprintf("has no element with id %q", fragment)
+	}
+	return ""
+}
+
+// readPage returns the content of a page as the server serves it.
+func (c *referenceChecker) readPage(file string) ([]byte, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return processPage(content, file, c.root, c.mounts, c.template)
+}
+
+// documentIDs returns the ids of the elements of a document, and the names of
+// its anchors, which fragments can also refer to.
+func documentIDs(content []byte) map[string]bool {
+	ids := map[string]bool{}
+	for _, token := range reExportToken.FindAllString(string(content), -1) {
+		if strings.HasPrefix(token, "<!--") {
+			continue
+		}
+		if parts := reElement.FindStringSubmatch(token); parts != nil {
+			token = parts[1]
+		}
+		isAnchor := strings.EqualFold(reTagName.FindStringSubmatch(token)[1], "a")
+		editAttributes(token, func(attr string, value string) (string, bool) {
+			if attr == "id" || (attr == "name" && isAnchor) {
+				ids[value] = true
+			}
+			return value, true
+		})
+	}
+	return ids
+}
+
+func isHTMLFile(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	return ext == ".html" || ext == ".htm"
+}
+
+// runCheck checks the references of a file, or of all HTML files in a
+// directory, and exits with an error when any is broken.
+func runCheck(args cliArgs) int {
+	target := args.Positional[0]
+	info, err := os.Stat(target)
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	root, files := filepath.Dir(target), []string{target}
+	if info.IsDir() {
+		root = target
+	}
+	config, _, err := resolveConfig(filepath.Join(root, "index.html"), args.Settings)
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	if info.IsDir() {
+		files = nil
+		err := filepath.WalkDir(target, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && file != target && (d.Name() == "node_modules" || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			// Layouts and partials are checked as part of the pages using them.
+			if d.IsDir() && config.Template && file == filepath.Join(root, templatesDir) {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && isHTMLFile(file) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Print(err)
+			return exitError
+		}
+	}
+
+	checker := newReferenceChecker(root, config.Mounts, config.SPA)
+	checker.template = config.Template
+	brokenCount, checkedCount := 0, 0
+	for _, file := range files {
+		broken, checked, err := checker.checkFile(file)
+		if err != nil {
+			log.Print(err)
+			return exitError
+		}
+		for _, b := range broken {
+			fmt.Println(b)
+		}
+		brokenCount += len(broken)
+		checkedCount += checked
+	}
+	color := Clr.Green
+	if brokenCount > 0 {
+		color = Clr.Red
+	}
+	fileCount := fmt.Sprintf("%d files", len(files))
+	if len(files) == 1 {
+		fileCount = "1 file"
+	}
+	fmt.Fprintf(os.Stderr, "%sChecked %d references in %s, %d broken%s\n", color, checkedCount, fileCount, brokenCount, Clr.Reset)
+	if brokenCount > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// referenceWarnings holds the broken references of the served file, as last
+// reported to the terminal and the browsers.
+var referenceWarnings struct {
+	sync.Mutex
+	list []string
+	// entry is the checked file, served with config.
+	entry  string
+	config Config
+}
+
+// watchReferences checks the references of the served file on start and
+// after every file change, until the context is canceled.
+func watchReferences(ctx context.Context, htmlFile string, config Config) {
+	defer restoreTerminalOnPanic()
+	changes, unsubscribe := watchedFiles.Subscribe()
+	defer unsubscribe()
+	reportBrokenReferences(htmlFile, config)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+			reportBrokenReferences(htmlFile, config)
+		}
+	}
+}
+
+// reportBrokenReferences checks the served file and reports references that
+// broke since the last check as warnings. Connected pages receive the list.
+func reportBrokenReferences(htmlFile string, config Config) {
+	checker := newReferenceChecker(filepath.Dir(htmlFile), config.Mounts, config.SPA)
+	checker.index = htmlFile
+	checker.template = config.Template
+	broken, _, err := checker.checkFile(htmlFile)
+	if err != nil {
+		return
+	}
+	warnings := make([]string, 0, len(broken))
+	for _, b := range broken {
+		warnings = append(warnings, b.String())
+	}
+
+	referenceWarnings.Lock()
+	previous := map[string]bool{}
+	for _, w := range referenceWarnings.list {
+		previous[w] = true
+	}
+	changed := len(previous) != len(warnings)
+	referenceWarnings.list = warnings
+	referenceWarnings.entry = htmlFile
+	referenceWarnings.config = config
+	referenceWarnings.Unlock()
+
+	for i, w := range warnings {
+		if previous[w] {
+			continue
+		}
+		changed = true
+		ServerState.RecordEvent("warning", w,
+			slog.String("file", broken[i].File),
+			slog.Int("line", broken[i].Line),
+			slog.String("url", broken[i].URL),
+		)
+	}
+	if !changed {
+		return
+	}
+	if len(warnings) == 0 {
+		ServerState.RecordEvent("check", "All references resolve")
+	}
+	broadcastWarnings(warnings)
+}
+
+// broadcastWarnings sends the broken references to the pages showing the
+// checked file.
+func broadcastWarnings(warnings []string) {
+	wsMutex.Lock()
+	defer wsMutex.Unlock()
+	for _, c := range wsClients {
+		if !c.dashboard && showsCheckedFile(c.page) {
+			sendWarnings(c, warnings)
+		}
+	}
+}
+
+// sendWarnings sends a "warnings" message with the broken references to a
+// client. The caller must hold wsMutex.
+func sendWarnings(client *wsClient, warnings []string) {
+	payload, _ := json.Marshal(warnings)
+	if err := sendPayload(client.conn, append([]byte("warnings "), payload...)); err != nil {
+		log.Printf("Error sending warnings: %v\n", err)
+	}
+}
+
+// showsCheckedFile reports whether a client page, the URL path and query it
+// connected from, shows the file checked for broken references: the served
+// file, or a client-side route with --spa. Other pages have other references.
+func showsCheckedFile(page string) bool {
+	referenceWarnings.Lock()
+	entry, config := referenceWarnings.entry, referenceWarnings.config
+	referenceWarnings.Unlock()
+	u, err := url.Parse(page)
+	if entry == "" || err != nil {
+		return false
+	}
+	if isIndexPath(u.Path, entry) {
+		return true
+	}
+	return config.SPA && path.Ext(u.Path) == "" && !fileExists(resolveURLPath(filepath.Dir(entry), config.Mounts, u.Path))
+}
+
+// currentWarnings returns the broken references of the last check.
+func currentWarnings() []string {
+	referenceWarnings.Lock()
+	defer referenceWarnings.Unlock()
+	return append([]string(nil), referenceWarnings.list...)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReferenceChecker(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html": `<html><head>
+<link rel="stylesheet" href="css/app.css">
+<link rel="stylesheet" href="css/typo.css">
+<link rel="preconnect" href="https://fonts.example.com">
+<script src="/js/app.js?v=3"></script>
+</head><body>
+<h1 id="intro">Intro</h1>
+<img src="img/logo.png" srcset="img/logo.png 1x, img/logo@2x.png 2x"><img srcset="data:image/png;base64,iVBOR,w0K 1x">
+<a href="#intro">Intro</a> <a href="#outro">Outro</a>
+<a href="docs/page.html#usage">Usage</a>
+<a href="docs/page.html#missing">Missing</a>
+<a href="docs/">Docs</a>
+<a href="/settings">Settings</a>
+<a href="mailto:someone@example.com">Mail</a>
+<script>document.write('<img src="inline.png">')</script>
+</body></html>`,
+		"css/app.css":     "",
+		"js/app.js":       "",
+		"img/logo.png":    "",
+		"docs/page.html":  `<html><body><h2 id="usage">Usage</h2></body></html>`,
+		"docs/index.html": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	index := filepath.Join(dir, "index.html")
+	broken, checked, err := newReferenceChecker(dir, nil, false).checkFile(index)
+	if err != nil {
+		t.Fatalf("Failed to check: %v", err)
+	}
+	var lines []string
+	for _, b := range broken {
+		lines = append(lines, strings.TrimPrefix(b.String(), index))
+	}
+	expected := []string{
+		`:3: <link href> "css/typo.css" not found`,
+		`:8: <img srcset> "img/logo@2x.png" not found`,
+		`:9: <a href> "#outro" has no element with id "outro"`,
+		`:11: <a href> "docs/page.html#missing" has no element with id "missing"`,
+		`:13: <a href> "/settings" not found`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected broken references\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+	if checked != 12 {
+		t.Fatalf("Expected 12 local references to be checked, got %d", checked)
+	}
+
+	broken, _, _ = newReferenceChecker(dir, nil, true).checkFile(index)
+	for _, b := range broken {
+		if b.URL == "/settings" {
+			t.Fatalf("Expected client-side routes to resolve with SPA, got %s", b)
+		}
+	}
+}
+
+func TestWatchReferences(t *testing.T) {
+	dir := t.TempDir()
+	index := filepath.Join(dir, "index.html")
+	os.WriteFile(index, []byte(`<img src="logo.png">`), 0644)
+	defer func() {
+		referenceWarnings.Lock()
+		referenceWarnings.list = nil
+		referenceWarnings.entry = ""
+		referenceWarnings.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchReferences(ctx, index, Config{})
+	waitForWarnings := func(expected int) {
+		deadline := time.Now().Add(2 * time.Second)
+		for len(currentWarnings()) != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d warnings, got %q", expected, currentWarnings())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitForWarnings(1)
+
+	os.WriteFile(filepath.Join(dir, "logo.png"), nil, 0644)
+	watchedFiles.Changed(index)
+	waitForWarnings(0)
+}
+
+func TestShowsCheckedFile(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "docs"), 0755)
+	index := filepath.Join(dir, "index.html")
+	defer func() {
+		referenceWarnings.Lock()
+		referenceWarnings.entry = ""
+		referenceWarnings.Unlock()
+	}()
+
+	for _, spa := range []bool{false, true} {
+		referenceWarnings.Lock()
+		referenceWarnings.entry, referenceWarnings.config = index, Config{SPA: spa}
+		referenceWarnings.Unlock()
+		for page, expected := range map[string]bool{
+			"/":               true,
+			"/index.html?x=1": true,
+			"/docs/guide.md":  false,
+			"/docs":           false,
+			"/settings":       spa,
+		} {
+			if showsCheckedFile(page) != expected {
+				t.Fatalf("Expected showsCheckedFile(%q) with spa %v to be %v", page, spa, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit codes of the command line.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command is a dotdev subcommand.
+type command struct {
+	Name string
+	// Args describes the positional arguments in the usage line.
+	Args    string
+	Summary string
+	// MinArgs and MaxArgs bound the number of positional arguments.
+	MinArgs, MaxArgs int
+	// Settings are the options the command accepts, besides --help and --version.
+	Settings []*configSetting
+	Run      func(args cliArgs) int
+}
+
+// cliArgs is a parsed command line.
+type cliArgs struct {
+	Positional []string
+	Settings   []settingValue
+	Help       bool
+	Version    bool
+}
+
+// defaultCommand runs when the first argument is not a command, so that
+// `dotdev index.html` serves the file.
+const defaultCommand = "serve"
+
+// commands lists the subcommands in the order of the help. It is filled in
+// init, as the help command refers to it.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			Name: "serve", Args: "<file>", Summary: "Serve an HTML file and reload browsers when it changes",
+			MinArgs: 1, MaxArgs: 1, Settings: configSettings, Run: runServe,
+		},
+		{
+			Name: "export", Args: "<file>", Summary: "Write a page as a single file with its assets inlined",
+			MinArgs: 1, MaxArgs: 1, Settings: append(exportSettings, findSetting(configSettings, "mount", true), findSetting(configSettings, "template", true)), Run: runExport,
+		},
+		{
+			Name: "check", Args: "<file|dir>", Summary: "Report references to missing files and fragments",
+			MinArgs: 1, MaxArgs: 1, Settings: []*configSetting{findSetting(configSettings, "mount", true), findSetting(configSettings, "spa", true), findSetting(configSettings, "template", true)}, Run: runCheck,
+		},
+		{
+			Name: "deps", Args: "<file>", Summary: "Print the files a page depends on, as a tree",
+			MinArgs: 1, MaxArgs: 1, Settings: append(depsSettings, findSetting(configSettings, "mount", true), findSetting(configSettings, "template", true)), Run: runDeps,
+		},
+		{
+			Name: "config", Args: "[file]", Summary: "Print the configuration resolved for a file",
+			MaxArgs: 1, Settings: configSettings, Run: runConfig,
+		},
+		{
+			Name: "version", Summary: "Print the version",
+			Run: func(cliArgs) int {
+				fmt.Printf("%s", Version)
+				return exitOK
+			},
+		},
+		{
+			Name: "help", Args: "[command]", Summary: "Print help information",
+			MaxArgs: 1, Run: runHelp,
+		},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// runCLI runs the command line and returns the exit code.
+func runCLI(args []string) int {
+	if len(args) == 0 {
+		printHelp(os.Stderr)
+		return exitUsage
+	}
+	cmd := findCommand(defaultCommand)
+	if found := findCommand(args[0]); found != nil {
+		cmd = found
+		args = args[1:]
+	}
+	parsed, err := parseArgs(args, cmd.Settings)
+	if err == nil && !parsed.Help && !parsed.Version {
+		switch {
+		case len(parsed.Positional) < cmd.MinArgs:
+			err = fmt.Errorf("missing argument %s", cmd.Args)
+		case len(parsed.Positional) > cmd.MaxArgs:
+			err = fmt.Errorf("unexpected argument %q", parsed.Positional[cmd.MaxArgs])
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%serror:%s %v\n\n", Clr.Red, Clr.Reset, err)
+		printUsage(os.Stderr, cmd)
+		fmt.Fprintf(os.Stderr, "\nRun 'dotdev help %s' for the list of options.\n", cmd.Name)
+		return exitUsage
+	}
+	switch {
+	case parsed.Version:
+		fmt.Printf("%s", Version)
+		return exitOK
+	case parsed.Help && cmd.Name == defaultCommand:
+		printHelp(os.Stdout)
+		return exitOK
+	case parsed.Help:
+		printCommandHelp(os.Stdout, cmd)
+		return exitOK
+	}
+	return cmd.Run(parsed)
+}
+
+// parseArgs parses options given anywhere among the positional arguments, as
+// --name value, --name=value, -n value or -n=value. Boolean options take no
+// value but accept --name=false. Arguments after -- are positional.
+func parseArgs(args []string, settings []*configSetting) (cliArgs, error) {
+	var parsed cliArgs
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			parsed.Positional = append(parsed.Positional, args[i+1:]...)
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			parsed.Positional = append(parsed.Positional, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		long := strings.HasPrefix(arg, "--")
+		switch {
+		case (long && name == "help") || (!long && name == "h"):
+			parsed.Help = true
+			continue
+		case (long && name == "version") || (!long && name == "v"):
+			parsed.Version = true
+			continue
+		}
+
+		setting := findSetting(settings, name, long)
+		if setting == nil {
+			return parsed, unknownOptionError(arg, name, settings)
+		}
+		if setting.isBool() {
+			if !hasValue {
+				value = "true"
+			}
+		} else if !hasValue {
+			if i+1 >= len(args) {
+				return parsed, fmt.Errorf("option %s needs a value <%s>", optionName(arg, name), setting.Arg)
+			}
+			i++
+			value = args[i]
+		}
+		if err := validateSetting(setting, value); err != nil {
+			return parsed, fmt.Errorf("option %s: %w", optionName(arg, name), err)
+		}
+		parsed.Settings = append(parsed.Settings, settingValue{setting: setting, value: value})
+	}
+	return parsed, nil
+}
+
+func findSetting(settings []*configSetting, name string, long bool) *configSetting {
+	for _, s := range settings {
+		if (long && s.Name == name) || (!long && s.Short != "" && s.Short == name) {
+			return s
+		}
+	}
+	return nil
+}
+
+func optionName(arg string, name string) string {
+	if strings.HasPrefix(arg, "--") {
+		return "--" + name
+	}
+	return "-" + name
+}
+
+// unknownOptionError reports an unknown option, suggesting a close match.
+func unknownOptionError(arg string, name string, settings []*configSetting) error {
+	option := optionName(arg, name)
+	best, bestDistance := "", 3
+	for _, s := range settings {
+		if d := editDistance(name, s.Name); d < bestDistance {
+			best, bestDistance = s.Name, d
+		}
+	}
+	if best != "" {
+		return fmt.Errorf("unknown option %s, did you mean --%s?", option, best)
+	}
+	return errors.New("unknown option " + option)
+}
+
+// editDistance is the Levenshtein distance of two strings.
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func runHelp(args cliArgs) int {
+	if len(args.Positional) == 0 {
+		printHelp(os.Stdout)
+		return exitOK
+	}
+	cmd := findCommand(args.Positional[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "%serror:%s unknown command %q\n\n", Clr.Red, Clr.Reset, args.Positional[0])
+		printHelp(os.Stderr)
+		return exitUsage
+	}
+	printCommandHelp(os.Stdout, cmd)
+	return exitOK
+}
+
+func printUsage(w io.Writer, cmd *command) {
+	fmt.Fprintf(w, "%sUSAGE:%s\n", Clr.Bold, Clr.Reset)
+	fmt.Fprintf(w, "    %s\n", usageLine(cmd))
+}
+
+func usageLine(cmd *command) string {
+	line := "dotdev " + cmd.Name
+	if cmd.Name == defaultCommand {
+		line = "dotdev [" + cmd.Name + "]"
+	}
+	if cmd.Args != "" {
+		line += " " + cmd.Args
+	}
+	if len(cmd.Settings) > 0 {
+		line += " [options]"
+	}
+	return line
+}
+
+// printHelp prints the commands and the options of the default command, all
+// generated from the command and setting tables.
+func printHelp(w io.Writer) {
+	fmt.Fprintf(w, "%sdotdev %sv%s%s\n", Clr.Bold, Clr.Neutral, Version, Clr.Reset)
+	fmt.Fprintf(w, "    Simple HTTP server with live reload\n\n")
+	fmt.Fprintf(w, "%sUSAGE:%s\n", Clr.Bold, Clr.Reset)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "    %s\n", usageLine(cmd))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "    %sCOMMANDS%s:\n", Clr.Underline, Clr.Reset)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "    %s%-8s%s %s\n", Clr.Bold, cmd.Name, Clr.Reset, cmd.Summary)
+	}
+	fmt.Fprintln(w)
+	printOptions(w, findCommand(defaultCommand))
+	fmt.Fprintf(w, "    %sCONFIGURATION%s:\n", Clr.Underline, Clr.Reset)
+	fmt.Fprintf(w, "        Options are also read from a dotdev.json or .dotdevrc file next to\n")
+	fmt.Fprintf(w, "        the served file or in a parent directory, and from DOTDEV_* environment\n")
+	fmt.Fprintf(w, "        variables such as DOTDEV_PORT. Flags take precedence over the environment,\n")
+	fmt.Fprintf(w, "        which takes precedence over the file. dotdev config prints the result.\n")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%sEXAMPLE%s:\n", Clr.Bold, Clr.Reset)
+	fmt.Fprintf(w, "echo \"<html><body>Hello World</body></html>\" > ./index.html\n")
+	fmt.Fprintf(w, "dotdev ./index.html --host localhost --port 4774\n")
+	fmt.Fprintln(w)
+}
+
+func printCommandHelp(w io.Writer, cmd *command) {
+	fmt.Fprintf(w, "%sdotdev %s%s - %s\n\n", Clr.Bold, cmd.Name, Clr.Reset, cmd.Summary)
+	printUsage(w, cmd)
+	fmt.Fprintln(w)
+	printOptions(w, cmd)
+}
+
+func printOptions(w io.Writer, cmd *command) {
+	fmt.Fprintf(w, "    %sOPTIONS%s:\n", Clr.Underline, Clr.Reset)
+	for _, s := range cmd.Settings {
+		usage := s.Usage
+		if s.List {
+			usage += ", can be repeated"
+		}
+		printOption(w, s.Short, s.Name, s.Arg, usage)
+	}
+	printOption(w, "h", "help", "", "Print help information")
+	printOption(w, "v", "version", "", "Print version")
+	fmt.Fprintln(w)
+}
+
+func printOption(w io.Writer, short string, name string, arg string, usage string) {
+	option := "--" + name
+	if short != "" {
+		option = "-" + short + ", " + option
+	}
+	if arg != "" {
+		option += " <" + arg + ">"
+	}
+	fmt.Fprintf(w, "    %s%s%s\n", Clr.Bold, option, Clr.Reset)
+	fmt.Fprintf(w, "        %s\n", usage)
+}
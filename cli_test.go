@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	args, err := parseArgs([]string{"--port", "9000", "index.html", "--spa", "-H", "X-A: 1", "--host=0.0.0.0", "-q=false", "--", "--odd"}, configSettings)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if strings.Join(args.Positional, " ") != "index.html --odd" {
+		t.Fatalf("Expected positional arguments around the flags, got %v", args.Positional)
+	}
+	config := defaultConfig()
+	applySettings(&config, args.Settings)
+	if config.Port != 9000 || !config.SPA || config.Host != "0.0.0.0" || config.Quiet || config.Headers.Get("X-A") != "1" {
+		t.Fatalf("Unexpected config: %+v", config)
+	}
+
+	args, err = parseArgs([]string{"index.html", "-h", "--version"}, configSettings)
+	if err != nil || !args.Help || !args.Version {
+		t.Fatalf("Expected help and version, got %+v, %v", args, err)
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	tests := []struct {
+		args    []string
+		message string
+	}{
+		{[]string{"index.html", "--prot", "9000"}, "unknown option --prot, did you mean --port?"},
+		{[]string{"-x"}, "unknown option -x"},
+		{[]string{"index.html", "--port"}, "option --port needs a value <PORT|auto>"},
+		{[]string{"-p", "http"}, `option -p: invalid port "http"`},
+		{[]string{"--spa=maybe"}, `option --spa: invalid boolean "maybe"`},
+	}
+	for _, tt := range tests {
+		_, err := parseArgs(tt.args, configSettings)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.message) {
+			t.Fatalf("Expected error %q for %v, got %v", tt.message, tt.args, err)
+		}
+	}
+}
+
+func TestRunCLIUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"index.html", "--prot", "9000"},
+		{"serve"},
+		{"serve", "a.html", "b.html"},
+		{"version", "--port", "1"},
+	} {
+		if code := runCLI(args); code != exitUsage {
+			t.Fatalf("Expected exit code %d for %v, got %d", exitUsage, args, code)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "net/http"
+
+// Config holds the settings of a dev server instance.
+type Config struct {
+	// Host and Port of the dev server.
+	Host string
+	Port int
+	// AutoPort tries the next ports when Port is taken.
+	AutoPort bool
+	// Listen holds additional addresses to listen on instead of Host and Port,
+	// as unix:PATH or HOST:PORT.
+	Listen []string
+	// URLFile receives the URL of the server once it listens.
+	URLFile string
+	// SPA serves the entry file for unknown routes so client-side routers can handle them.
+	SPA bool
+	// ResolveModules resolves bare module specifiers against node_modules
+	// with an import map injected into the served file.
+	ResolveModules bool
+	// Template renders pages with html/template, using the templates of the
+	// _templates directory and the data files of the data directory.
+	Template bool
+	// Mounts serve additional directories under URL prefixes.
+	Mounts []Mount
+	// Headers are added to every response, before the rules of a _headers file.
+	Headers http.Header
+	// Verbose logs additional details, such as the _redirects rule matched by a request.
+	Verbose bool
+	// LogFormat is one of LogFormatPretty, LogFormatPlain or LogFormatJSON.
+	LogFormat string
+	// Quiet only reports the server URLs and errors.
+	Quiet bool
+	// AccessLog is a file every request is appended to, in AccessLogFormat.
+	AccessLog       string
+	AccessLogFormat string
+}
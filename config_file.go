@@ -0,0 +1,585 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// configFileNames are the names of the project configuration file, looked up
+// in the directory of the served file and then in its parents.
+var configFileNames = []string{"dotdev.json", ".dotdevrc"}
+
+// configEnvPrefix prefixes the environment variables of the settings, such as
+// DOTDEV_PORT for --port.
+const configEnvPrefix = "DOTDEV_"
+
+// configSetting is a setting that can be given in the config file, as a
+// DOTDEV_* environment variable and as a flag. Settings are applied in layers,
+// defaults < config file < environment < flags, and a list given in a layer
+// replaces the list of the layers below.
+type configSetting struct {
+	// Name is the flag name. The config file key is its camel case form,
+	// unless Key is set, and the environment variable its upper case form
+	// with the DOTDEV_ prefix.
+	Name string
+	Key  string
+	// Short is the single letter alias of the flag, if any.
+	Short string
+	// Arg names the value in the help, it is empty for boolean settings.
+	Arg   string
+	Usage string
+	// List settings can be given several times. Separator splits the values
+	// of a single environment variable.
+	List      bool
+	Separator string
+	// Env is an environment variable giving the default of the setting, below
+	// the config file. Empty and invalid values are ignored.
+	Env string
+	// Path makes paths in a value relative to dir absolute, for values of the
+	// config file, which are relative to its directory.
+	Path  func(value string, dir string) string
+	Apply func(c *Config, value string) error
+	Reset func(c *Config)
+	// Value returns the setting of a resolved config, for `dotdev config`.
+	Value func(c Config) any
+}
+
+// settingValue is a value given for a setting by one of the layers.
+type settingValue struct {
+	setting *configSetting
+	value   string
+}
+
+var configSettings = []*configSetting{
+	{
+		Name: "host", Arg: "HOST", Usage: "Host of the dev server", Env: "HOST",
+		Apply: func(c *Config, v string) error { c.Host = v; return nil },
+		Value: func(c Config) any { return c.Host },
+	},
+	{
+		Name: "port", Short: "p", Arg: "PORT|auto", Usage: "Port of the dev server, auto tries the next ports when it is taken", Env: "PORT",
+		Apply: func(c *Config, v string) error {
+			f := &portFlag{port: c.Port}
+			if err := f.Set(v); err != nil {
+				return err
+			}
+			c.Port, c.AutoPort = f.port, f.auto
+			return nil
+		},
+		Value: func(c Config) any {
+			if c.AutoPort {
+				return PortAuto
+			}
+			return c.Port
+		},
+	},
+	{
+		Name: "listen", Arg: "unix:PATH|HOST:PORT", Usage: "Listen on a Unix socket or address instead of the host and port",
+		List: true, Separator: ",",
+		Path: func(v string, dir string) string {
+			if path, ok := strings.CutPrefix(v, "unix:"); ok {
+				return "unix:" + resolvePath(path, dir)
+			}
+			return v
+		},
+		Apply: func(c *Config, v string) error {
+			if _, _, err := parseListenAddress(v); err != nil {
+				return err
+			}
+			c.Listen = append(c.Listen, v)
+			return nil
+		},
+		Reset: func(c *Config) { c.Listen = nil },
+		Value: func(c Config) any { return append([]string{}, c.Listen...) },
+	},
+	{
+		Name: "url-file", Arg: "FILE", Usage: "Write the server URL to a file once it listens",
+		Path:  resolvePath,
+		Apply: func(c *Config, v string) error { c.URLFile = v; return nil },
+		Value: func(c Config) any { return c.URLFile },
+	},
+	{
+		Name: "spa", Usage: "Serve the file for unknown routes of a single-page app",
+		Apply: boolSetting(func(c *Config) *bool { return &c.SPA }),
+		Value: func(c Config) any { return c.SPA },
+	},
+	{
+		Name: "resolve-modules", Usage: "Resolve bare module imports from node_modules with an injected import map",
+		Apply: boolSetting(func(c *Config) *bool { return &c.ResolveModules }),
+		Value: func(c Config) any { return c.ResolveModules },
+	},
+	{
+		Name: "template", Usage: "Render pages as Go templates with the data files of the data directory",
+		Apply: boolSetting(func(c *Config) *bool { return &c.Template }),
+		Value: func(c Config) any { return c.Template },
+	},
+	{
+		Name: "mount", Key: "mounts", Short: "m", Arg: "/PREFIX=DIR", Usage: "Serve a directory under a URL prefix",
+		List: true, Separator: ",",
+		Path: func(v string, dir string) string {
+			if prefix, mountDir, ok := strings.Cut(v, "="); ok && mountDir != "" {
+				return prefix + "=" + resolvePath(mountDir, dir)
+			}
+			return v
+		},
+		Apply: func(c *Config, v string) error {
+			m, err := parseMount(v)
+			if err != nil {
+				return err
+			}
+			c.Mounts = append(c.Mounts, m)
+			return nil
+		},
+		Reset: func(c *Config) { c.Mounts = nil },
+		Value: func(c Config) any {
+			mounts := map[string]string{}
+			for _, m := range c.Mounts {
+				mounts[m.Prefix] = m.Dir
+			}
+			return mounts
+		},
+	},
+	{
+		Name: "header", Key: "headers", Short: "H", Arg: "'NAME: VALUE'", Usage: "Add a response header",
+		List: true, Separator: "\n",
+		Apply: func(c *Config, v string) error {
+			name, value, err := parseHeaderLine(v)
+			if err != nil {
+				return err
+			}
+			if c.Headers == nil {
+				c.Headers = http.Header{}
+			}
+			c.Headers.Add(name, value)
+			return nil
+		},
+		Reset: func(c *Config) { c.Headers = http.Header{} },
+		Value: func(c Config) any {
+			headers := map[string]string{}
+			for name, values := range c.Headers {
+				headers[name] = strings.Join(values, ", ")
+			}
+			return headers
+		},
+	},
+	{
+		Name: "verbose", Usage: "Log additional details about requests",
+		Apply: boolSetting(func(c *Config) *bool { return &c.Verbose }),
+		Value: func(c Config) any { return c.Verbose },
+	},
+	{
+		Name: "log-format", Arg: "pretty|plain|json", Usage: "Output format of the log, pretty on a terminal and plain otherwise",
+		Apply: func(c *Config, v string) error {
+			if v != "" {
+				if _, err := resolveLogFormat(v); err != nil {
+					return err
+				}
+			}
+			c.LogFormat = v
+			return nil
+		},
+		Value: func(c Config) any { return c.LogFormat },
+	},
+	{
+		Name: "quiet", Short: "q", Usage: "Only print the server URL and errors",
+		Apply: boolSetting(func(c *Config) *bool { return &c.Quiet }),
+		Value: func(c Config) any { return c.Quiet },
+	},
+	{
+		Name: "access-log", Arg: "FILE", Usage: "Append every request to a file",
+		Path:  resolvePath,
+		Apply: func(c *Config, v string) error { c.AccessLog = v; return nil },
+		Value: func(c Config) any { return c.AccessLog },
+	},
+	{
+		Name: "access-log-format", Arg: "clf|json", Usage: "Format of the access log file, Common Log Format by default",
+		Apply: func(c *Config, v string) error {
+			if v != AccessLogFormatCLF && v != AccessLogFormatJSON {
+				return fmt.Errorf("invalid access log format %q, expected %s or %s", v, AccessLogFormatCLF, AccessLogFormatJSON)
+			}
+			c.AccessLogFormat = v
+			return nil
+		},
+		Value: func(c Config) any { return c.AccessLogFormat },
+	},
+}
+
+func boolSetting(field func(c *Config) *bool) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func resolvePath(path string, dir string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func (s *configSetting) isBool() bool {
+	return s.Arg == ""
+}
+
+// fileKey is the key of the setting in the config file, e.g. accessLogFormat.
+func (s *configSetting) fileKey() string {
+	if s.Key != "" {
+		return s.Key
+	}
+	parts := strings.Split(s.Name, "-")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+	}
+	return strings.Join(parts, "")
+}
+
+// envName is the environment variable of the setting, e.g. DOTDEV_ACCESS_LOG.
+func (s *configSetting) envName() string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(s.Name, "-", "_"))
+}
+
+// defaultConfig returns the config before any layer is applied.
+func defaultConfig() Config {
+	return Config{
+		Host:            DEFAULT_HOST,
+		Port:            DEFAULT_PORT,
+		Headers:         http.Header{},
+		AccessLogFormat: AccessLogFormatCLF,
+	}
+}
+
+// resolveConfig builds the effective config of the served file from the
+// defaults, the config file found next to it or in a parent directory, the
+// environment and the flags. It returns the path of the config file used.
+func resolveConfig(serveFile string, flags []settingValue) (Config, string, error) {
+	config := defaultConfig()
+	applySettings(&config, envDefaults())
+	dir, err := filepath.Abs(filepath.Dir(serveFile))
+	if err != nil {
+		return config, "", err
+	}
+	configFile := findConfigFile(dir)
+	if configFile != "" {
+		values, err := loadConfigFile(configFile)
+		if err != nil {
+			return config, configFile, err
+		}
+		applySettings(&config, values)
+	}
+	values, err := envSettings()
+	if err != nil {
+		return config, configFile, err
+	}
+	applySettings(&config, values)
+	applySettings(&config, flags)
+	if err := checkMounts(config.Mounts); err != nil {
+		return config, configFile, err
+	}
+	return config, configFile, nil
+}
+
+// findConfigFile looks for a config file in dir and its parents.
+func findConfigFile(dir string) string {
+	for {
+		for _, name := range configFileNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// applySettings applies the validated values of a layer to the config.
+func applySettings(config *Config, values []settingValue) {
+	reset := map[*configSetting]bool{}
+	for _, v := range values {
+		if v.setting.List && !reset[v.setting] {
+			v.setting.Reset(config)
+			reset[v.setting] = true
+		}
+		v.setting.Apply(config, v.value)
+	}
+}
+
+// validateSetting checks a value by applying it to a scratch config.
+func validateSetting(s *configSetting, value string) error {
+	scratch := defaultConfig()
+	return s.Apply(&scratch, value)
+}
+
+// envSettings returns the settings given as DOTDEV_ environment variables.
+func envSettings() ([]settingValue, error) {
+	var values []settingValue
+	for _, s := range configSettings {
+		name := s.envName()
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		parts := []string{env}
+		if s.List {
+			parts = strings.Split(env, s.Separator)
+		}
+		for _, part := range parts {
+			if s.List && strings.TrimSpace(part) == "" {
+				continue
+			}
+			if err := validateSetting(s, part); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			values = append(values, settingValue{setting: s, value: part})
+		}
+	}
+	return values, nil
+}
+
+// envDefaults returns the defaults given by the generic environment variables
+// of the settings, such as PORT. They predate the config file and rank below
+// it, and like before, an invalid value falls back to the built-in default.
+func envDefaults() []settingValue {
+	var values []settingValue
+	for _, s := range configSettings {
+		if s.Env == "" {
+			continue
+		}
+		env := os.Getenv(s.Env)
+		if env == "" || validateSetting(s, env) != nil {
+			continue
+		}
+		values = append(values, settingValue{setting: s, value: env})
+	}
+	return values
+}
+
+// configFileError is an error in the config file, at a line.
+type configFileError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *configFileError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.Path, e.Line, e.Err)
+}
+
+func (e *configFileError) Unwrap() error {
+	return e.Err
+}
+
+// loadConfigFile reads and validates a config file. It is a JSON object with
+// the camel case names of the flags as keys, e.g.
+//
+//	{
+//	  "port": "auto",
+//	  "spa": true,
+//	  "mounts": {"/vendor": "node_modules"},
+//	  "headers": {"Cache-Control": "no-store"}
+//	}
+//
+// Relative paths are relative to the directory of the file.
+func loadConfigFile(path string) ([]settingValue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	fail := func(offset int64, err error) error {
+		return &configFileError{Path: path, Line: lineAt(data, offset), Err: err}
+	}
+	settings := map[string]*configSetting{}
+	for _, s := range configSettings {
+		settings[s.fileKey()] = s
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fail(skipSpace(data, 0), errors.New("expected a JSON object"))
+	}
+	var values []settingValue
+	seen := map[string]bool{}
+	for dec.More() {
+		keyOffset := skipSpace(data, dec.InputOffset())
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fail(keyOffset, jsonError(err))
+		}
+		key := tok.(string)
+		s, ok := settings[key]
+		if !ok {
+			return nil, fail(keyOffset, fmt.Errorf("unknown setting %q", key))
+		}
+		if seen[key] {
+			return nil, fail(keyOffset, fmt.Errorf("duplicate setting %q", key))
+		}
+		seen[key] = true
+		valueOffset := skipSpace(data, dec.InputOffset())
+		var raw any
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fail(valueOffset, jsonError(err))
+		}
+		parts, err := settingFileValues(s, raw)
+		if err != nil {
+			return nil, fail(valueOffset, fmt.Errorf("%s: %w", key, err))
+		}
+		for _, part := range parts {
+			if s.Path != nil {
+				part = s.Path(part, dir)
+			}
+			if err := validateSetting(s, part); err != nil {
+				return nil, fail(valueOffset, fmt.Errorf("%s: %w", key, err))
+			}
+			values = append(values, settingValue{setting: s, value: part})
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fail(dec.InputOffset(), jsonError(err))
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fail(skipSpace(data, dec.InputOffset()), errors.New("unexpected data after the JSON object"))
+	}
+	return values, nil
+}
+
+// settingFileValues converts a JSON value of the config file to the values
+// of the setting, as they would be given on the command line.
+func settingFileValues(s *configSetting, raw any) ([]string, error) {
+	scalar := func(v any) (string, error) {
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case json.Number:
+			if s.isBool() {
+				return "", errors.New("expected true or false")
+			}
+			return v.String(), nil
+		case bool:
+			if !s.isBool() {
+				return "", errors.New("expected a string")
+			}
+			return strconv.FormatBool(v), nil
+		}
+		if s.isBool() {
+			return "", errors.New("expected true or false")
+		}
+		return "", errors.New("expected a string")
+	}
+	if !s.List {
+		v, err := scalar(raw)
+		if err != nil {
+			return nil, err
+		}
+		return []string{v}, nil
+	}
+
+	switch raw := raw.(type) {
+	case []any:
+		values := make([]string, 0, len(raw))
+		for _, item := range raw {
+			v, err := scalar(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	case map[string]any:
+		// Mounts and headers can be given as objects, {"/prefix": "dir"} and
+		// {"Name": "value"}.
+		separator := "="
+		if s.Name == "header" {
+			separator = ": "
+		} else if s.Name != "mount" {
+			return nil, errors.New("expected an array")
+		}
+		keys := make([]string, 0, len(raw))
+		for k := range raw {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		values := make([]string, 0, len(raw))
+		for _, k := range keys {
+			v, err := scalar(raw[k])
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, k+separator+v)
+		}
+		return values, nil
+	}
+	v, err := scalar(raw)
+	if err != nil {
+		return nil, err
+	}
+	return []string{v}, nil
+}
+
+// jsonError drops the offset details of JSON syntax errors, which are
+// reported as line numbers instead.
+func jsonError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errors.New("unexpected end of file")
+	}
+	return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+}
+
+// skipSpace returns the offset of the next character that is not white space
+// or a JSON separator.
+func skipSpace(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) {
+		c := rune(data[offset])
+		if !unicode.IsSpace(c) && c != ',' && c != ':' {
+			break
+		}
+		offset++
+	}
+	return offset
+}
+
+// lineAt returns the 1-based line of the offset.
+func lineAt(data []byte, offset int64) int {
+	offset = min(offset, int64(len(data)))
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// writeConfig prints the resolved config as a config file.
+func writeConfig(w io.Writer, config Config) error {
+	var b bytes.Buffer
+	b.WriteString("{\n")
+	for i, s := range configSettings {
+		key, _ := json.Marshal(s.fileKey())
+		value, err := json.MarshalIndent(s.Value(config), "  ", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "  %s: %s", key, value)
+		if i < len(configSettings)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestResolveConfig verifies the precedence of the layers: defaults, the
+// config file of a parent directory, the environment and the flags.
+func TestResolveConfig(t *testing.T) {
+	root := t.TempDir()
+	siteDir := filepath.Join(root, "site")
+	os.MkdirAll(siteDir, 0755)
+	htmlPath := filepath.Join(siteDir, "index.html")
+	os.WriteFile(htmlPath, []byte(`<html></html>`), 0644)
+	os.WriteFile(filepath.Join(root, "dotdev.json"), []byte(`{
+  "host": "0.0.0.0",
+  "port": 5000,
+  "spa": true,
+  "mounts": {"/vendor": "node_modules"},
+  "headers": {"Cache-Control": "no-store"},
+  "accessLog": "logs/access.log"
+}`), 0644)
+	t.Setenv("DOTDEV_PORT", "auto")
+	t.Setenv("DOTDEV_HEADER", "X-Env: 1")
+
+	args, err := parseArgs([]string{"--host", "localhost", "--spa=false"}, configSettings)
+	if err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+	config, configFile, err := resolveConfig(htmlPath, args.Settings)
+	if err != nil {
+		t.Fatalf("Failed to resolve config: %v", err)
+	}
+	if configFile != filepath.Join(root, "dotdev.json") {
+		t.Fatalf("Expected config file of the parent directory, got %q", configFile)
+	}
+	if config.Host != "localhost" || config.SPA {
+		t.Fatalf("Expected flags to override the file, got host %q spa %v", config.Host, config.SPA)
+	}
+	if config.Port != 5000 || !config.AutoPort {
+		t.Fatalf("Expected auto port starting at 5000, got %d %v", config.Port, config.AutoPort)
+	}
+	if config.Headers.Get("X-Env") != "1" || config.Headers.Get("Cache-Control") != "" {
+		t.Fatalf("Expected environment headers to replace the file headers, got %v", config.Headers)
+	}
+	if len(config.Mounts) != 1 || config.Mounts[0].Dir != filepath.Join(root, "node_modules") {
+		t.Fatalf("Expected mount relative to the config file, got %v", config.Mounts)
+	}
+	if config.AccessLog != filepath.Join(root, "logs/access.log") || config.AccessLogFormat != AccessLogFormatCLF {
+		t.Fatalf("Expected access log relative to the config file, got %q %q", config.AccessLog, config.AccessLogFormat)
+	}
+
+	var out strings.Builder
+	writeConfig(&out, config)
+	for _, want := range []string{`"host": "localhost"`, `"port": "auto"`, `"X-Env": "1"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("Expected printed config to contain %s, got:\n%s", want, out.String())
+		}
+	}
+}
+
+// TestEnvDefaults verifies that HOST and PORT rank below the config file, and
+// that an invalid PORT falls back to the default.
+func TestEnvDefaults(t *testing.T) {
+	dir := t.TempDir()
+	htmlPath := filepath.Join(dir, "index.html")
+	os.WriteFile(filepath.Join(dir, "dotdev.json"), []byte(`{"port": 5000}`), 0644)
+	t.Setenv("HOST", "0.0.0.0")
+	t.Setenv("PORT", "6000")
+	config, _, err := resolveConfig(htmlPath, nil)
+	if err != nil {
+		t.Fatalf("Failed to resolve config: %v", err)
+	}
+	if config.Host != "0.0.0.0" || config.Port != 5000 {
+		t.Fatalf("Expected HOST to apply and the config file to override PORT, got %s:%d", config.Host, config.Port)
+	}
+
+	t.Setenv("PORT", "http")
+	config, _, err = resolveConfig(filepath.Join(t.TempDir(), "index.html"), nil)
+	if err != nil || config.Port != DEFAULT_PORT {
+		t.Fatalf("Expected an invalid PORT to fall back to %d, got %d, %v", DEFAULT_PORT, config.Port, err)
+	}
+}
+
+func TestMountErrors(t *testing.T) {
+	for _, flags := range [][]string{{"--mount", "/__dotdev=x"}, {"--mount", "/__dotdev/node_modules=x"}, {"--mount", "ws=x"}} {
+		if _, err := parseArgs(flags, configSettings); err == nil || !strings.Contains(err.Error(), "reserved") {
+			t.Fatalf("Expected %v to be rejected as reserved, got %v", flags, err)
+		}
+	}
+
+	htmlPath := filepath.Join(t.TempDir(), "index.html")
+	args, err := parseArgs([]string{"--mount", "/ui=a", "--mount", "/ui/=b"}, configSettings)
+	if err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+	if _, _, err := resolveConfig(htmlPath, args.Settings); err == nil || !strings.Contains(err.Error(), "mount /ui is given twice") {
+		t.Fatalf("Expected an error for the same prefix mounted twice, got %v", err)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		line    int
+		message string
+	}{
+		{"{\n  \"port\": 4774,\n  \"prot\": 1\n}", 3, `unknown setting "prot"`},
+		{"{\n  \"spa\": \"yes\"\n}", 2, "spa: invalid boolean"},
+		{"{\n  \"host\": \"a\",\n\n  \"port\": \"http\"\n}", 4, "port: invalid port"},
+		{"{\n  \"logFormat\": \"xml\"\n}", 2, "invalid log format"},
+		{"{\n  \"host\": [\"a\"]\n}", 2, "host: expected a string"},
+		{"{\n  \"host\": \"a\"\n  \"port\": 1\n}", 3, "invalid character"},
+		{"[]", 1, "expected a JSON object"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), ".dotdevrc")
+		os.WriteFile(path, []byte(tt.content), 0644)
+		_, err := loadConfigFile(path)
+		var fileErr *configFileError
+		if !errors.As(err, &fileErr) {
+			t.Fatalf("Expected a config file error for %q, got %v", tt.content, err)
+		}
+		if fileErr.Line != tt.line || !strings.Contains(err.Error(), tt.message) {
+			t.Fatalf("Expected %q at line %d, got %v", tt.message, tt.line, err)
+		}
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	os.MkdirAll(nested, 0755)
+	os.WriteFile(filepath.Join(root, "a", ".dotdevrc"), []byte(`{}`), 0644)
+	if got := findConfigFile(nested); got != filepath.Join(root, "a", ".dotdevrc") {
+		t.Fatalf("Expected .dotdevrc of the parent directory, got %q", got)
+	}
+	os.WriteFile(filepath.Join(nested, "dotdev.json"), []byte(`{}`), 0644)
+	if got := findConfigFile(nested); got != filepath.Join(nested, "dotdev.json") {
+		t.Fatalf("Expected the closest config file, got %q", got)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RequestRecord describes a handled HTTP request.
+type RequestRecord struct {
+	Time     time.Time     `json:"time"`
+	Method   string        `json:"method"`
+	Path     string        `json:"path"`
+	Status   int           `json:"status"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+	Injected bool          `json:"injected"`
+}
+
+// maxRecentRequests is the number of requests kept for the dashboard.
+const maxRecentRequests = 100
+
+// requestHistory keeps the most recent requests, oldest first.
+type requestHistory struct {
+	mu       sync.Mutex
+	requests []RequestRecord
+}
+
+var recentRequests = &requestHistory{}
+
+func (h *requestHistory) Add(record RequestRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests = append(h.requests, record)
+	if len(h.requests) > maxRecentRequests {
+		h.requests = append([]RequestRecord(nil), h.requests[len(h.requests)-maxRecentRequests:]...)
+	}
+}
+
+func (h *requestHistory) List() []RequestRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]RequestRecord(nil), h.requests...)
+}
+
+type dashboardClient struct {
+	RemoteAddr  string    `json:"remoteAddr"`
+	UserAgent   string    `json:"userAgent"`
+	Page        string    `json:"page"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+type dashboardFile struct {
+	Path       string     `json:"path"`
+	LastChange *time.Time `json:"lastChange"`
+	Changes    int        `json:"changes"`
+}
+
+type dashboardEvent struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+}
+
+// dashboardData is the document pushed to dashboards over the WebSocket.
+type dashboardData struct {
+	Type     string            `json:"type"`
+	Status   serverStatus      `json:"status"`
+	Clients  []dashboardClient `json:"clients"`
+	Files    []dashboardFile   `json:"files"`
+	Requests []RequestRecord   `json:"requests"`
+	Reloads  []dashboardEvent  `json:"reloads"`
+}
+
+// reloadEventKinds are the events listed as reload events on the dashboard.
+var reloadEventKinds = map[string]bool{
+	"change": true,
+	"reload": true,
+	"skip":   true,
+	"pause":  true,
+	"resume": true,
+}
+
+func newDashboardData(state State) dashboardData {
+	data := dashboardData{
+		Type:     "dashboard",
+		Status:   newServerStatus(state),
+		Clients:  []dashboardClient{},
+		Files:    []dashboardFile{},
+		Requests: recentRequests.List(),
+		Reloads:  []dashboardEvent{},
+	}
+	wsMutex.Lock()
+	for _, c := range wsClients {
+		if c.dashboard {
+			continue
+		}
+		data.Clients = append(data.Clients, dashboardClient{
+			RemoteAddr:  c.remoteAddr,
+			UserAgent:   c.userAgent,
+			Page:        c.page,
+			ConnectedAt: c.connectedAt,
+		})
+	}
+	wsMutex.Unlock()
+	for _, f := range watchedFiles.List() {
+		file := dashboardFile{Path: f.Path, Changes: f.Changes}
+		if !f.LastChange.IsZero() {
+			lastChange := f.LastChange
+			file.LastChange = &lastChange
+		}
+		data.Files = append(data.Files, file)
+	}
+	for _, e := range state.Events {
+		if reloadEventKinds[e.Kind] {
+			data.Reloads = append(data.Reloads, dashboardEvent{Time: e.Time, Kind: e.Kind, Message: e.Message})
+		}
+	}
+	return data
+}
+
+var dashboardUpdatesOnce sync.Once
+
+// startDashboardUpdates pushes the dashboard data to connected dashboards on
+// every state change and once a second, so uptime and request logs stay current.
+// It is started when the first dashboard connects.
+func startDashboardUpdates() {
+	dashboardUpdatesOnce.Do(func() {
+		updates, _ := ServerState.Subscribe()
+		ticker := time.NewTicker(time.Second)
+		go func() {
+			defer restoreTerminalOnPanic()
+			state := <-updates
+			for {
+				pushDashboard(state)
+				var ok bool
+				select {
+				case state, ok = <-updates:
+					if !ok {
+						ticker.Stop()
+						return
+					}
+				case <-ticker.C:
+					state = ServerState.Snapshot()
+				}
+			}
+		}()
+	})
+	go pushDashboard(ServerState.Snapshot())
+}
+
+// pushDashboard sends the dashboard data to all connected dashboards.
+func pushDashboard(state State) {
+	payload, err := json.Marshal(newDashboardData(state))
+	if err != nil {
+		log.Printf("Error encoding dashboard data: %v\n", err)
+		return
+	}
+	wsMutex.Lock()
+	defer wsMutex.Unlock()
+	for _, c := range wsClients {
+		if c.dashboard {
+			sendPayload(c.conn, payload)
+		}
+	}
+}
+
+// dashboardHandler serves the dashboard page and its actions.
+func dashboardHandler() http.HandlerFunc {
+	page, err := fs.ReadFile(assetsFs, "assets/dashboard.html")
+	if err != nil {
+		log.Printf("Error reading dashboard.html. Dashboard will not work.\n")
+	}
+	page = []byte(strings.ReplaceAll(string(page), "{{dotdev::version}}", Version))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		action := strings.TrimPrefix(r.URL.Path, internalPathPrefix)
+		switch action {
+		case "":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write(page)
+			return
+		case "reload", "pause":
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if !isSameOrigin(r) {
+				http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+				return
+			}
+			if action == "reload" {
+				ServerState.RecordEvent("reload", "Reload triggered from the dashboard")
+				forceReload()
+			} else {
+				togglePause()
+			}
+			statusHandler(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	}
+}
+
+// isSameOrigin reports whether a request was sent by a page of the server
+// itself, so other sites open in the browser cannot trigger actions. Requests
+// without the Origin and Sec-Fetch-Site headers do not come from a browser
+// page and are allowed.
+func isSameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" {
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return false
+		}
+	}
+	return true
+}
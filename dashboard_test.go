@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDashboard verifies the dashboard page, its live data and its actions.
+func TestDashboard(t *testing.T) {
+	tmpDir := t.TempDir()
+	htmlPath := filepath.Join(tmpDir, "index.html")
+	os.WriteFile(htmlPath, []byte(`<html><body>Hello</body></html>`), 0644)
+
+	ts := httptest.NewServer(DevServer(htmlPath, Config{}))
+	defer ts.Close()
+
+	page := getHtmlContent(t, ts.URL+"/__dotdev/")
+	if !strings.Contains(page, "dotdev dashboard") || !strings.Contains(page, Version) {
+		t.Fatalf("Expected dashboard page, got: %s", page)
+	}
+	getHtmlContent(t, ts.URL+"/")
+
+	u, _ := url.Parse(ts.URL)
+	conn := dialWebSocketPath(t, u.Host, "/ws?dashboard=1")
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var data dashboardData
+	if err := json.Unmarshal(readLargeWebSocketMessage(t, conn), &data); err != nil {
+		t.Fatalf("Failed to decode dashboard data: %v", err)
+	}
+	if data.Type != "dashboard" || data.Status.ServePath != ServerState.Snapshot().ServePath {
+		t.Fatalf("Unexpected dashboard data: %+v", data)
+	}
+	found := false
+	for _, r := range data.Requests {
+		found = found || (r.Path == "/" && r.Status == http.StatusOK)
+	}
+	if !found {
+		t.Fatalf("Expected request log to contain GET /, got %+v", data.Requests)
+	}
+
+	for _, want := range []bool{true, false} {
+		resp, err := http.Post(ts.URL+"/__dotdev/pause", "", nil)
+		if err != nil {
+			t.Fatalf("POST pause failed: %v", err)
+		}
+		var status serverStatus
+		json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		if status.Paused != want {
+			t.Fatalf("Expected paused to be %v, got %v", want, status.Paused)
+		}
+	}
+
+	for _, headers := range []map[string]string{
+		{"Origin": "https://evil.example"},
+		{"Sec-Fetch-Site": "cross-site"},
+		{"Origin": ts.URL, "Sec-Fetch-Site": "same-site"},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/__dotdev/pause", nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST pause failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden || ServerState.Snapshot().Paused {
+			t.Fatalf("Expected a cross-origin request with %v to be rejected, got %d", headers, resp.StatusCode)
+		}
+	}
+	for origin, expected := range map[string]int{
+		"https://evil.example": http.StatusForbidden,
+		ts.URL:                 http.StatusSwitchingProtocols,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/ws?dashboard=1", nil)
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Sec-WebSocket-Key", "x3JJHMbDL1EzLkh9GBhXDw==")
+		req.Header.Set("Origin", origin)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Dashboard WebSocket handshake failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Fatalf("Expected the dashboard WebSocket from %s to get %d, got %d", origin, expected, resp.StatusCode)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/__dotdev/pause", nil)
+	req.Header.Set("Origin", ts.URL)
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST pause failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !ServerState.Snapshot().Paused {
+		t.Fatalf("Expected a same-origin request to be accepted, got %d", resp.StatusCode)
+	}
+	togglePause()
+
+	resp, err = http.Get(ts.URL + "/__dotdev/reload")
+	if err != nil {
+		t.Fatalf("GET reload failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected 405 for GET reload, got %d", resp.StatusCode)
+	}
+}
+
+// dialWebSocketPath performs the dialWebSocket handshake on a path with a query.
+func dialWebSocketPath(t *testing.T, host string, path string) net.Conn {
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %v", host, err)
+	}
+	handshake := "GET " + path + " HTTP/1.1\r\n" +
+		"Host: " + host + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: x3JJHMbDL1EzLkh9GBhXDw==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(handshake)); err != nil {
+		t.Fatalf("Failed to write handshake: %v", err)
+	}
+	// Read the response headers byte by byte, so no frame data is buffered away.
+	var head []byte
+	buf := make([]byte, 1)
+	for !strings.HasSuffix(string(head), "\r\n\r\n") {
+		if _, err := conn.Read(buf); err != nil {
+			t.Fatalf("Failed to read handshake response: %v", err)
+		}
+		head = append(head, buf[0])
+	}
+	if !strings.HasPrefix(string(head), "HTTP/1.1 101") {
+		t.Fatalf("Expected 101 Switching Protocols, got %s", head)
+	}
+	return conn
+}
+
+// readLargeWebSocketMessage reads a single unmasked frame of any length.
+func readLargeWebSocketMessage(t *testing.T, conn net.Conn) []byte {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatalf("Failed to read ws header: %v", err)
+	}
+	payloadLen := uint64(header[1] & 0x7F)
+	switch payloadLen {
+	case 126:
+		ext := make([]byte, 2)
+		io.ReadFull(conn, ext)
+		payloadLen = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		io.ReadFull(conn, ext)
+		payloadLen = binary.BigEndian.Uint64(ext)
+	}
+	payload := make([]byte, payloadLen)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		t.Fatalf("Failed to read ws payload: %v", err)
+	}
+	return payload
+}
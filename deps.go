@@ -0,0 +1,446 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Kinds of the files in the dependency graph. Only documents, stylesheets
+// and scripts are scanned for further dependencies.
+const (
+	dependencyHTML     = "html"
+	dependencyMarkdown = "markdown"
+	dependencyCSS      = "css"
+	dependencyJS       = "js"
+	dependencyAsset    = "asset"
+)
+
+var (
+	reJSImport        = regexp.MustCompile(`(?m)(?:^|[;\s}])(?:import|export)\s*(?:[\w$*{}\s,]*?\s*from\s*)?["']([^"'\n]+)["']`)
+	reJSDynamicImport = regexp.MustCompile(`\bimport\s*\(\s*["']([^"'\n]+)["']\s*\)`)
+)
+
+// dependencyNode is a file of the dependency graph.
+type dependencyNode struct {
+	File    string   `json:"file"`
+	URL     string   `json:"url"`
+	Kind    string   `json:"kind"`
+	Missing bool     `json:"missing,omitempty"`
+	Deps    []string `json:"deps"`
+
+	url *url.URL
+}
+
+// dependencyGraph holds the files an HTML file depends on, transitively:
+// scripts, stylesheets, their imports, and the media, fonts and icons
+// referenced along the way. Links to other pages are not dependencies.
+type dependencyGraph struct {
+	Entry string            `json:"entry"`
+	Nodes []*dependencyNode `json:"files"`
+
+	root           string
+	mounts         []Mount
+	resolveModules bool
+	template       bool
+	byFile         map[string]*dependencyNode
+	// imports maps bare module specifiers to URLs, from the import maps of
+	// the scanned documents.
+	imports map[string]*url.URL
+	// moduleImports maps the bare specifiers resolved from node_modules to
+	// URL paths, for the import map injected with --resolve-modules.
+	moduleImports map[string]string
+}
+
+// buildDependencyGraph scans the entry file and the files it references,
+// breadth first. Files are resolved like the dev server serves them, from the
+// directory of the entry file and the mounts.
+func buildDependencyGraph(entry string, config Config) *dependencyGraph {
+	return buildPageDependencyGraph(filepath.Dir(entry), entry, config)
+}
+
+// buildPageDependencyGraph builds the dependency graph of a page served from
+// the root directory, which may be in a subdirectory of it.
+func buildPageDependencyGraph(root string, entry string, config Config) *dependencyGraph {
+	g := &dependencyGraph{
+		Entry:          entry,
+		root:           root,
+		mounts:         config.Mounts,
+		resolveModules: config.ResolveModules,
+		template:       config.Template,
+		byFile:         map[string]*dependencyNode{},
+		imports:        map[string]*url.URL{},
+		moduleImports:  map[string]string{},
+	}
+	kind := dependencyHTML
+	if isMarkdownFile(entry) {
+		kind = dependencyMarkdown
+	}
+	g.add(entry, documentURL(root, g.mounts, entry), kind)
+	for i := 0; i < len(g.Nodes); i++ {
+		node := g.Nodes[i]
+		content, err := os.ReadFile(node.File)
+		if err != nil {
+			node.Missing = true
+			continue
+		}
+		switch node.Kind {
+		case dependencyHTML:
+			g.scanPage(node, content)
+		case dependencyMarkdown:
+			// A Markdown document depends on its layout and what the rendered
+			// page references.
+			if fileExists(filepath.Join(root, markdownLayoutFile)) {
+				g.addDependency(node, &url.URL{Path: "/"}, markdownLayoutFile, dependencyAsset)
+			}
+			if page, err := renderMarkdownPage(node.File, root); err == nil {
+				g.scanPage(node, page)
+			}
+		case dependencyCSS:
+			g.scanCSS(node, node.url, string(content))
+		case dependencyJS:
+			g.scanJS(node, node.url, string(content))
+		}
+	}
+	return g
+}
+
+// add returns the node of a file, adding it to the graph when it is new.
+func (g *dependencyGraph) add(file string, u *url.URL, kind string) *dependencyNode {
+	if node, ok := g.byFile[file]; ok {
+		return node
+	}
+	node := &dependencyNode{File: file, URL: u.Path, Kind: kind, Deps: []string{}, url: u}
+	g.byFile[file] = node
+	g.Nodes = append(g.Nodes, node)
+	return node
+}
+
+// addDependency records a reference of a node. References that are remote,
+// empty or resolve to a directory are ignored. The kind of the referenced file
+// is taken from its extension, unless given.
+func (g *dependencyGraph) addDependency(node *dependencyNode, base *url.URL, ref string, kind string) {
+	u, ok := localReference(base, ref)
+	if !ok || strings.HasSuffix(u.Path, "/") {
+		return
+	}
+	u = &url.URL{Path: u.Path}
+	file := resolveURLPath(g.root, g.mounts, u.Path)
+	if info, err := os.Stat(file); err == nil && info.IsDir() {
+		return
+	}
+	if kind == "" {
+		kind = dependencyKind(file)
+	}
+	dep := g.add(file, u, kind)
+	for _, f := range node.Deps {
+		if f == dep.File {
+			return
+		}
+	}
+	node.Deps = append(node.Deps, dep.File)
+}
+
+func dependencyKind(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".html", ".htm":
+		return dependencyHTML
+	case ".md", ".markdown":
+		return dependencyMarkdown
+	case ".css":
+		return dependencyCSS
+	case ".js", ".mjs":
+		return dependencyJS
+	}
+	return dependencyAsset
+}
+
+// scanPage records the partials a served document includes, and the
+// references of the document with its partials included.
+func (g *dependencyGraph) scanPage(node *dependencyNode, content []byte) {
+	expanded, partials, err := expandIncludes(content, node.File, g.root, g.mounts)
+	for _, partial := range partials {
+		g.addFile(node, partial)
+	}
+	if err == nil {
+		content = expanded
+	}
+	if g.template && node.Kind == dependencyHTML {
+		for _, file := range templateFiles(g.root) {
+			g.addFile(node, file)
+		}
+		if rendered, err := renderTemplate(content, node.File, g.root); err == nil {
+			content = rendered
+		}
+	}
+	g.scanHTML(node, content)
+}
+
+// addFile records a file a node depends on without being referenced by URL,
+// such as a partial or a data file.
+func (g *dependencyGraph) addFile(node *dependencyNode, file string) {
+	u := &url.URL{Path: filepath.ToSlash(file)}
+	if urlPath, ok := fileURLPath(g.root, g.mounts, file); ok {
+		u.Path = urlPath
+	}
+	dep := g.add(file, u, dependencyAsset)
+	if !slices.Contains(node.Deps, dep.File) {
+		node.Deps = append(node.Deps, dep.File)
+	}
+}
+
+// scanHTML records the references of a document, and those of its inline
+// styles, module scripts and import maps.
+func (g *dependencyGraph) scanHTML(node *dependencyNode, content []byte) {
+	base := node.url
+	for _, ref := range scanHTMLReferences(content) {
+		switch {
+		case ref.Tag == "base":
+			if u, err := base.Parse(strings.TrimSpace(ref.URL)); err == nil {
+				base = u
+			}
+		case pageLinkTags[ref.Tag]:
+		case ref.Tag == "script":
+			g.addDependency(node, base, ref.URL, dependencyJS)
+		default:
+			g.addDependency(node, base, ref.URL, "")
+		}
+	}
+
+	for _, token := range reExportToken.FindAllString(string(content), -1) {
+		if strings.HasPrefix(token, "<!--") {
+			continue
+		}
+		parts := reElement.FindStringSubmatch(token)
+		if parts == nil {
+			if style, ok := tagAttribute(token, "style"); ok {
+				g.scanCSS(node, base, style)
+			}
+			continue
+		}
+		tag := strings.ToLower(reTagName.FindStringSubmatch(token)[1])
+		if tag == "style" {
+			g.scanCSS(node, base, parts[2])
+			continue
+		}
+		if _, hasSrc := tagAttribute(parts[1], "src"); hasSrc {
+			continue
+		}
+		switch scriptType, _ := tagAttribute(parts[1], "type"); strings.ToLower(scriptType) {
+		case "importmap":
+			g.addImportMap(base, parts[2])
+		case "module":
+			g.scanJS(node, base, parts[2])
+		}
+	}
+}
+
+// addImportMap records the imports of an import map, resolved against the
+// URL of its document. Scopes are not supported.
+func (g *dependencyGraph) addImportMap(base *url.URL, content string) {
+	var importMap struct {
+		Imports map[string]string `json:"imports"`
+	}
+	if err := json.Unmarshal([]byte(content), &importMap); err != nil {
+		return
+	}
+	for specifier, target := range importMap.Imports {
+		if u, err := base.Parse(target); err == nil {
+			g.imports[specifier] = u
+		}
+	}
+}
+
+// scanCSS records the imports and url() references of a stylesheet located
+// at base.
+func (g *dependencyGraph) scanCSS(node *dependencyNode, base *url.URL, css string) {
+	for _, m := range reCSSRef.FindAllStringSubmatch(css, -1) {
+		if strings.HasPrefix(m[0], "/*") {
+			continue
+		}
+		if ref := m[2] + m[4]; ref != "" {
+			g.addDependency(node, base, ref, dependencyCSS)
+		} else {
+			g.addDependency(node, base, m[6], "")
+		}
+	}
+}
+
+// scanJS records the static imports, re-exports and dynamic imports with a
+// literal specifier of a module located at base.
+func (g *dependencyGraph) scanJS(node *dependencyNode, base *url.URL, js string) {
+	var specifiers []string
+	for _, m := range reJSImport.FindAllStringSubmatch(js, -1) {
+		specifiers = append(specifiers, m[1])
+	}
+	for _, m := range reJSDynamicImport.FindAllStringSubmatch(js, -1) {
+		specifiers = append(specifiers, m[1])
+	}
+	for _, specifier := range specifiers {
+		if u, ok := g.resolveSpecifier(node, base, specifier); ok {
+			g.addDependency(node, base, u.String(), dependencyJS)
+		}
+	}
+}
+
+// resolveSpecifier resolves a module specifier imported by node. Relative and
+// absolute URLs are kept, bare specifiers are looked up in the import maps, by
+// exact match or by the longest prefix ending in a slash, and then in
+// node_modules with --resolve-modules.
+func (g *dependencyGraph) resolveSpecifier(node *dependencyNode, base *url.URL, specifier string) (*url.URL, bool) {
+	if strings.HasPrefix(specifier, "/") || strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../") {
+		u, err := base.Parse(specifier)
+		return u, err == nil
+	}
+	if u, ok := g.imports[specifier]; ok {
+		return u, true
+	}
+	best := ""
+	for prefix := range g.imports {
+		if strings.HasSuffix(prefix, "/") && strings.HasPrefix(specifier, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best != "" {
+		u, err := g.imports[best].Parse(strings.TrimPrefix(specifier, best))
+		return u, err == nil
+	}
+	if !g.resolveModules {
+		return nil, false
+	}
+	if urlPath, ok := g.moduleImports[specifier]; ok {
+		return &url.URL{Path: urlPath}, true
+	}
+	file, ok := resolveBareSpecifier(filepath.Dir(node.File), specifier)
+	if !ok {
+		return nil, false
+	}
+	urlPath, ok := fileURLPath(g.root, g.mounts, file)
+	if !ok {
+		return nil, false
+	}
+	g.moduleImports[specifier] = urlPath
+	return &url.URL{Path: urlPath}, true
+}
+
+// Files returns the files of the graph, the entry first. Missing files are
+// included, so a page referencing a file before it is created reloads once it
+// is.
+func (g *dependencyGraph) Files() []string {
+	var files []string
+	for _, node := range g.Nodes {
+		files = append(files, node.File)
+	}
+	return files
+}
+
+// writeTree prints the graph as a tree. Files reached again are listed
+// without their dependencies.
+func (g *dependencyGraph) writeTree(w io.Writer) {
+	printed := map[string]bool{}
+	var printNode func(node *dependencyNode, prefix string, branch string, last bool)
+	printNode = func(node *dependencyNode, prefix string, branch string, last bool) {
+		name := g.displayName(node)
+		note := ""
+		switch {
+		case node.Missing:
+			note = fmt.Sprintf(" %s(missing)%s", Clr.Red, Clr.Reset)
+		case printed[node.File] && len(node.Deps) > 0:
+			note = fmt.Sprintf(" %s(see above)%s", Clr.Neutral, Clr.Reset)
+		}
+		fmt.Fprintf(w, "%s%s%s%s\n", prefix, branch, name, note)
+		if printed[node.File] {
+			return
+		}
+		printed[node.File] = true
+		if branch != "" {
+			if last {
+				prefix += "    "
+			} else {
+				prefix += "│   "
+			}
+		}
+		for i, dep := range node.Deps {
+			isLast := i == len(node.Deps)-1
+			branch := "├── "
+			if isLast {
+				branch = "└── "
+			}
+			printNode(g.byFile[dep], prefix, branch, isLast)
+		}
+	}
+	printNode(g.Nodes[0], "", "", true)
+}
+
+// displayName is the path of a node relative to the root, or its absolute
+// path when it is outside, like files under mounts.
+func (g *dependencyGraph) displayName(node *dependencyNode) string {
+	if rel, err := filepath.Rel(g.root, node.File); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return node.File
+}
+
+// dependencyGraphHandler serves the dependency graph of the served file as JSON.
+func dependencyGraphHandler(htmlFile string, config Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(buildDependencyGraph(htmlFile, config)); err != nil {
+			log.Printf("Error writing dependency graph: %v\n", err)
+		}
+	}
+}
+
+// depsSettings are the options specific to the deps command.
+var depsSettings = []*configSetting{
+	{
+		Name: "json", Usage: "Print the graph as JSON",
+		Apply: func(c *Config, v string) error { _, err := strconv.ParseBool(v); return err },
+	},
+}
+
+// runDeps prints the dependency graph of the file given as the argument.
+func runDeps(args cliArgs) int {
+	htmlFile := args.Positional[0]
+	asJSON := false
+	var flags []settingValue
+	for _, v := range args.Settings {
+		if v.setting.Name == "json" {
+			asJSON, _ = strconv.ParseBool(v.value)
+		} else {
+			flags = append(flags, v)
+		}
+	}
+	if _, err := os.Stat(htmlFile); err != nil {
+		log.Print(err)
+		return exitError
+	}
+	config, _, err := resolveConfig(htmlFile, flags)
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	config = withNodeModules(config, filepath.Dir(htmlFile))
+	graph := buildDependencyGraph(htmlFile, config)
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(graph); err != nil {
+			log.Print(err)
+			return exitError
+		}
+		return exitOK
+	}
+	graph.writeTree(os.Stdout)
+	return exitOK
+}
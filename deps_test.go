@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html": `<html><head>
+<link rel="stylesheet" href="css/app.css">
+<link rel="icon" href="favicon.ico">
+<link rel="modulepreload" href="js/util.js">
+<script type="importmap">{"imports": {"lib": "/vendor/lib.js", "lib/": "/vendor/lib/"}}</script>
+<script type="module" src="js/main.js"></script>
+<script type="module">import "lib/extra.js";</script>
+<style>body { background: url(img/bg.png) }</style>
+</head><body>
+<img src="img/a.png" srcset="img/a.png 1x, img/a@2x.png 2x">
+<video poster="img/poster.jpg"><source src="media/clip.mp4"></video>
+<a href="other.html">Other</a>
+</body></html>`,
+		"css/app.css":         `@import "base.css"; .logo { background: url("../img/a.png") }`,
+		"css/base.css":        `@font-face { src: url(/fonts/sans.woff2) } /* url(ignored.png) */`,
+		"js/main.js":          "import { util } from './util.js';\nexport * from \"./reexport.js\";\nimport lib from 'lib';\nconst lazy = () => import('./lazy.js');\n",
+		"js/util.js":          "export const util = 1;",
+		"js/reexport.js":      "",
+		"js/lazy.js":          "import './missing.js';",
+		"vendor/lib.js":       "",
+		"vendor/lib/extra.js": "",
+		"img/a.png":           "",
+		"img/a@2x.png":        "",
+		"img/bg.png":          "",
+		"img/poster.jpg":      "",
+		"media/clip.mp4":      "",
+		"fonts/sans.woff2":    "",
+		"favicon.ico":         "",
+		"other.html":          "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	graph := buildDependencyGraph(filepath.Join(dir, "index.html"), Config{})
+	colors := Clr
+	Clr = Colors{}
+	defer func() { Clr = colors }()
+	var tree bytes.Buffer
+	graph.writeTree(&tree)
+	expected := `index.html
+├── css/app.css
+│   ├── css/base.css
+│   │   └── fonts/sans.woff2
+│   └── img/a.png
+├── favicon.ico
+├── js/util.js
+├── js/main.js
+│   ├── js/util.js
+│   ├── js/reexport.js
+│   ├── vendor/lib.js
+│   └── js/lazy.js
+│       └── js/missing.js (missing)
+├── img/a.png
+├── img/a@2x.png
+├── img/poster.jpg
+├── media/clip.mp4
+├── vendor/lib/extra.js
+└── img/bg.png
+`
+	if tree.String() != expected {
+		t.Fatalf("Expected tree\n%s\ngot\n%s", expected, tree.String())
+	}
+
+	watched := graph.Files()
+	if len(watched) != 17 || !strings.Contains(strings.Join(watched, " "), "missing.js") {
+		t.Fatalf("Expected the 17 files to be watched, including the missing one, got %v", watched)
+	}
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportOptions are the options of `dotdev export`.
+type exportOptions struct {
+	// Output is the exported file, the standard output when empty or "-".
+	Output string
+	// MaxInlineSize leaves larger assets as references, 0 inlines any size.
+	MaxInlineSize int64
+	// InlineRemote downloads and inlines http(s) assets instead of leaving
+	// their URLs untouched.
+	InlineRemote bool
+}
+
+// exportSettings are the options specific to the export command. They are
+// only validated when parsed, runExport reads them into exportOptions.
+var exportSettings = []*configSetting{
+	{
+		Name: "output", Short: "o", Arg: "FILE", Usage: "Write the exported page to a file instead of the standard output",
+		Apply: func(c *Config, v string) error { return nil },
+	},
+	{
+		Name: "max-inline-size", Arg: "SIZE", Usage: "Keep assets larger than SIZE, e.g. 500k or 2M, as references",
+		Apply: func(c *Config, v string) error { _, err := parseSize(v); return err },
+	},
+	{
+		Name: "inline-remote", Usage: "Download and inline http(s) assets instead of keeping their URLs",
+		Apply: func(c *Config, v string) error { _, err := strconv.ParseBool(v); return err },
+	},
+}
+
+// runExport writes the file given as the argument as a single self-contained
+// page, with its stylesheets, scripts, images and fonts inlined and without
+// the live reload snippet.
+func runExport(args cliArgs) int {
+	htmlFile := args.Positional[0]
+	var options exportOptions
+	var flags []settingValue
+	for _, v := range args.Settings {
+		switch v.setting.Name {
+		case "output":
+			options.Output = v.value
+		case "max-inline-size":
+			options.MaxInlineSize, _ = parseSize(v.value)
+		case "inline-remote":
+			options.InlineRemote, _ = strconv.ParseBool(v.value)
+		default:
+			flags = append(flags, v)
+		}
+	}
+	config, _, err := resolveConfig(htmlFile, flags)
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	if options.Output != "" && options.Output != "-" && sameFile(options.Output, htmlFile) {
+		log.Printf("Refusing to overwrite %s with its export, choose another --output\n", htmlFile)
+		return exitError
+	}
+	content, err := readPage(htmlFile, filepath.Dir(htmlFile))
+	if err == nil {
+		content, err = processPage(content, htmlFile, filepath.Dir(htmlFile), config.Mounts, config.Template)
+	}
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+
+	exporter := newExporter(filepath.Dir(htmlFile), config.Mounts, options)
+	exported, err := exporter.exportHTML(content, documentURL(filepath.Dir(htmlFile), config.Mounts, htmlFile).Path)
+	if err != nil {
+		log.Printf("Error exporting %s: %v\n", htmlFile, err)
+		return exitError
+	}
+	output := "standard output"
+	if options.Output == "" || options.Output == "-" {
+		_, err = os.Stdout.Write(exported)
+	} else {
+		output = options.Output
+		err = os.WriteFile(options.Output, exported, 0644)
+	}
+	if err != nil {
+		log.Printf("Error writing %s: %v\n", output, err)
+		return exitError
+	}
+	exporter.printReport(os.Stderr, filepath.Base(htmlFile), len(content), output, len(exported))
+	return exitOK
+}
+
+// sameFile reports whether two paths refer to the same existing file.
+func sameFile(a string, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// parseSize parses a size in bytes, with an optional k or M suffix.
+func parseSize(value string) (int64, error) {
+	v := strings.ToLower(strings.TrimSpace(value))
+	v = strings.TrimSuffix(v, "b")
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(v, "k"):
+		unit, v = 1024, strings.TrimSuffix(v, "k")
+	case strings.HasSuffix(v, "m"):
+		unit, v = 1024*1024, strings.TrimSuffix(v, "m")
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a number of bytes with an optional k or M suffix", value)
+	}
+	return n * unit, nil
+}
+
+// formatSize formats a number of bytes for the export report.
+func formatSize(n int) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f kB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+}
+
+// Outcomes of an asset in the export report.
+const (
+	exportInlined  = "inlined"
+	exportKept     = "kept"
+	exportMissing  = "missing"
+	exportTooLarge = "larger than --max-inline-size"
+	exportRemote   = "remote, use --inline-remote to inline it"
+	exportModule   = "module script with imports, bundle it to inline it"
+)
+
+// exportedAsset is an asset referenced by the exported page.
+type exportedAsset struct {
+	Ref     string
+	Status  string
+	Reason  string
+	Size    int
+	content []byte
+}
+
+var errRemoteAsset = errors.New("remote asset")
+
+var (
+	reExportToken = regexp.MustCompile(`(?is)<!--.*?-->|<script\b[^>]*>.*?</script\s*>|<style\b[^>]*>.*?</style\s*>|<[a-z][a-z0-9-]*\b[^>]*>`)
+	reTagName     = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9-]*)`)
+	reElement     = regexp.MustCompile(`(?is)^(<[a-z]+\b[^>]*>)(.*?)(</[a-z]+\s*>)$`)
+	reAttribute   = regexp.MustCompile(`(?s)(\s)([a-zA-Z_:][a-zA-Z0-9_:.-]*)(?:\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+))?`)
+	reCSSRef      = regexp.MustCompile(`(?is)/\*.*?\*/|@import\s+(?:(["'])(.*?)["']|url\(\s*(["']?)(.*?)["']?\s*\))|url\(\s*(["']?)(.*?)["']?\s*\)`)
+)
+
+// exporter inlines the assets of a page. References are resolved as URLs,
+// relative to the URL of the document or stylesheet they appear in, and
+// served from the root directory and the mounts like the dev server does.
+type exporter struct {
+	root    string
+	mounts  []Mount
+	options exportOptions
+	client  *http.Client
+
+	base      *url.URL
+	assets    []*exportedAsset
+	loaded    map[string]*exportedAsset
+	importing map[string]bool
+}
+
+func newExporter(root string, mounts []Mount, options exportOptions) *exporter {
+	return &exporter{
+		root:      root,
+		mounts:    mounts,
+		options:   options,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		loaded:    map[string]*exportedAsset{},
+		importing: map[string]bool{},
+	}
+}
+
+// exportHTML returns the document served at docPath with its assets inlined.
+func (e *exporter) exportHTML(content []byte, docPath string) ([]byte, error) {
+	switch detectCharset(content) {
+	case "utf-16le", "utf-16be":
+		return nil, errors.New("UTF-16 documents are not supported")
+	}
+	e.base = &url.URL{Path: docPath}
+	// Tokens are replaced in a single pass, so the inlined contents are
+	// never scanned for references again.
+	exported := reExportToken.ReplaceAllStringFunc(string(content), func(token string) string {
+		if strings.HasPrefix(token, "<!--") {
+			return token
+		}
+		m := reTagName.FindStringSubmatch(token)
+		switch strings.ToLower(m[1]) {
+		case "script":
+			return e.exportScript(token)
+		case "style":
+			parts := reElement.FindStringSubmatch(token)
+			return e.exportTag(parts[1]) + escapeClosingTag(e.exportCSS(parts[2], e.base), "style") + parts[3]
+		case "link":
+			return e.exportLink(token)
+		case "base":
+			if href, ok := tagAttribute(token, "href"); ok {
+				if base, err := e.base.Parse(href); err == nil {
+					e.base = base
+				}
+			}
+			return token
+		}
+		return e.exportTag(token)
+	})
+	return []byte(exported), nil
+}
+
+// exportScript inlines the file of a <script src>. Deferred and async scripts
+// get a data URL instead, so they still run after the document is parsed.
+// Module scripts with imports are kept, as their imports would no longer
+// resolve, and reported.
+func (e *exporter) exportScript(element string) string {
+	parts := reElement.FindStringSubmatch(element)
+	typ, _ := tagAttribute(parts[1], "type")
+	isModule := strings.EqualFold(strings.TrimSpace(typ), "module")
+	m := reScriptSrc.FindStringSubmatch(element)
+	if m == nil {
+		if isModule && hasModuleImports(parts[2]) {
+			e.assets = append(e.assets, &exportedAsset{Ref: "inline module script in " + e.base.Path, Status: exportKept, Reason: exportModule})
+		}
+		return element
+	}
+	loc, content, ok := e.load(e.base, html.UnescapeString(m[1]), false)
+	if !ok {
+		return element
+	}
+	if isModule && hasModuleImports(string(content)) {
+		asset := e.loaded[loc.String()]
+		asset.Status, asset.Reason = exportKept, exportModule
+		return element
+	}
+	_, isDeferred := tagAttribute(parts[1], "defer")
+	_, isAsync := tagAttribute(parts[1], "async")
+	if isDeferred || isAsync {
+		tag := setAttribute(parts[1], "src", dataURL("text/javascript", content))
+		return tag + parts[3]
+	}
+	tag := removeAttribute(parts[1], "src")
+	return tag + escapeClosingTag(string(content), "script") + parts[3]
+}
+
+// exportLink turns stylesheet links into <style> elements and icons into data
+// URLs. Other links are kept.
+func (e *exporter) exportLink(tag string) string {
+	if m := reStylesheetHref.FindStringSubmatch(tag); m != nil {
+		loc, content, ok := e.load(e.base, html.UnescapeString(m[1]), true)
+		if !ok {
+			return tag
+		}
+		style := "<style"
+		if media, ok := tagAttribute(tag, "media"); ok {
+			style += ` media="` + html.EscapeString(media) + `"`
+		}
+		return style + ">" + escapeClosingTag(e.exportCSS(string(content), loc), "style") + "</style>"
+	}
+	if rel, _ := tagAttribute(tag, "rel"); strings.Contains(strings.ToLower(rel), "icon") {
+		return editAttributes(tag, func(name string, value string) (string, bool) {
+			if name == "href" {
+				value = e.inlineURL(e.base, value, false)
+			}
+			return value, true
+		})
+	}
+	return tag
+}
+
+// exportTag inlines the media referenced by a start tag and the url() of its
+// style attribute.
+func (e *exporter) exportTag(tag string) string {
+	name := strings.ToLower(reTagName.FindStringSubmatch(tag)[1])
+	media := false
+	switch name {
+	case "img", "source", "video", "audio", "track", "embed", "input":
+		media = true
+	}
+	return editAttributes(tag, func(attr string, value string) (string, bool) {
+		switch {
+		case attr == "style":
+			return e.exportCSS(value, e.base), true
+		case media && (attr == "src" || attr == "poster"):
+			return e.inlineURL(e.base, value, false), true
+		case media && attr == "srcset":
+			return e.exportSrcset(value), true
+		}
+		return value, true
+	})
+}
+
+// exportSrcset inlines the candidates of a srcset attribute.
+func (e *exporter) exportSrcset(srcset string) string {
+	var candidates []string
+	for _, candidate := range parseSrcset(srcset) {
+		inlined := e.inlineURL(e.base, candidate.URL, false)
+		if candidate.Descriptor != "" {
+			inlined += " " + candidate.Descriptor
+		}
+		candidates = append(candidates, inlined)
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// exportCSS inlines the url() references and imports of a stylesheet located
+// at base. Imported stylesheets are exported recursively.
+func (e *exporter) exportCSS(css string, base *url.URL) string {
+	return reCSSRef.ReplaceAllStringFunc(css, func(token string) string {
+		if strings.HasPrefix(token, "/*") {
+			return token
+		}
+		m := reCSSRef.FindStringSubmatch(token)
+		if strings.HasPrefix(strings.ToLower(token), "@import") {
+			ref := strings.TrimSpace(m[2] + m[4])
+			inlined := e.inlineURL(base, ref, true)
+			if inlined == ref {
+				return token
+			}
+			return "@import url(" + inlined + ")"
+		}
+		ref := strings.TrimSpace(m[6])
+		isCSS := strings.EqualFold(path.Ext(strings.SplitN(ref, "?", 2)[0]), ".css")
+		inlined := e.inlineURL(base, ref, isCSS)
+		if inlined == ref {
+			return token
+		}
+		return "url(" + inlined + ")"
+	})
+}
+
+// inlineURL returns the data URL of a reference, or the reference itself when
+// it is not inlined. Stylesheets are exported before being encoded.
+func (e *exporter) inlineURL(base *url.URL, ref string, isCSS bool) string {
+	loc, content, ok := e.load(base, ref, isCSS)
+	if !ok {
+		return ref
+	}
+	if isCSS {
+		key := loc.String()
+		if e.importing[key] {
+			return ref
+		}
+		e.importing[key] = true
+		content = []byte(e.exportCSS(string(content), loc))
+		delete(e.importing, key)
+		return dataURL("text/css", content)
+	}
+	return dataURL(assetMimeType(loc.Path, content), content)
+}
+
+// load resolves a reference and reads the asset. It reports false for
+// references that are not inlined, such as anchors, data URLs, remote URLs
+// without --inline-remote, missing files and files over the size limit.
+func (e *exporter) load(base *url.URL, ref string, isCSS bool) (*url.URL, []byte, bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return nil, nil, false
+	}
+	loc, ok := localReference(base, ref)
+	if ok {
+		loc.RawQuery = ""
+	} else {
+		remote, err := base.Parse(ref)
+		if err != nil {
+			return nil, nil, false
+		}
+		if remote.Scheme == "" && remote.Host != "" {
+			remote.Scheme = "https"
+		}
+		if remote.Scheme != "http" && remote.Scheme != "https" {
+			return nil, nil, false
+		}
+		loc = remote
+	}
+	loc.Fragment = ""
+
+	key := loc.String()
+	asset, ok := e.loaded[key]
+	if !ok {
+		asset = &exportedAsset{Ref: key}
+		content, err := e.read(loc)
+		switch {
+		case errors.Is(err, errRemoteAsset):
+			asset.Status, asset.Reason = exportKept, exportRemote
+		case err != nil:
+			asset.Status, asset.Reason = exportMissing, err.Error()
+		case e.options.MaxInlineSize > 0 && int64(len(content)) > e.options.MaxInlineSize:
+			asset.Status, asset.Reason = exportKept, exportTooLarge
+		default:
+			asset.Status, asset.content = exportInlined, content
+		}
+		asset.Size = len(content)
+		e.loaded[key] = asset
+		e.assets = append(e.assets, asset)
+	}
+	return loc, asset.content, asset.content != nil
+}
+
+// read returns the content of a local or remote asset.
+func (e *exporter) read(loc *url.URL) ([]byte, error) {
+	if loc.Scheme == "" {
+		file := resolveURLPath(e.root, e.mounts, loc.Path)
+		if info, err := os.Stat(file); err == nil && info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory", file)
+		}
+		return os.ReadFile(file)
+	}
+	if !e.options.InlineRemote {
+		return nil, errRemoteAsset
+	}
+	resp, err := e.client.Get(loc.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", loc, resp.Status)
+	}
+	body := io.Reader(resp.Body)
+	if e.options.MaxInlineSize > 0 {
+		// Reading one byte over the limit is enough to know it is exceeded.
+		body = io.LimitReader(body, e.options.MaxInlineSize+1)
+	}
+	return io.ReadAll(body)
+}
+
+// printReport prints the assets of the export with their sizes.
+func (e *exporter) printReport(w io.Writer, htmlName string, htmlSize int, output string, outputSize int) {
+	inlined := 0
+	for _, a := range e.assets {
+		color := Clr.Green
+		switch {
+		case a.Status == exportMissing:
+			color = Clr.Red
+		case a.Status == exportKept:
+			color = Clr.Yellow
+		}
+		if a.Status == exportInlined {
+			inlined++
+		}
+		details := []string{a.Ref}
+		if a.Size > 0 {
+			details = append(details, formatSize(a.Size))
+		}
+		if a.Reason != "" {
+			details = append(details, "("+a.Reason+")")
+		}
+		fmt.Fprintf(w, "  %s%-8s%s %s\n", color, a.Status, Clr.Reset, strings.Join(details, "  "))
+	}
+	assets := "assets"
+	if inlined == 1 {
+		assets = "asset"
+	}
+	fmt.Fprintf(w, "%sExported %s to %s: %s, from %s and %d inlined %s%s\n",
+		Clr.Bold, htmlName, output, formatSize(outputSize), formatSize(htmlSize), inlined, assets, Clr.Reset)
+}
+
+// hasModuleImports reports whether a module script imports other modules.
+func hasModuleImports(js string) bool {
+	return reJSImport.MatchString(js) || reJSDynamicImport.MatchString(js)
+}
+
+// assetMimeType returns the media type of an asset for its data URL.
+func assetMimeType(assetPath string, content []byte) string {
+	mimeType := mime.TypeByExtension(path.Ext(assetPath))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(content)
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return strings.TrimSpace(mimeType)
+}
+
+// dataURL encodes content as a base64 data URL. It contains no quotes or
+// spaces, so it can be used unquoted in CSS.
+func dataURL(mimeType string, content []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(content)
+}
+
+// escapeClosingTag keeps inlined content from closing its element early.
+func escapeClosingTag(content string, tag string) string {
+	re := regexp.MustCompile(`(?i)</(` + tag + `)`)
+	return re.ReplaceAllString(content, `<\/$1`)
+}
+
+// editAttributes calls edit with the lowercase name and the unescaped value
+// of every attribute of a start tag. Attributes whose value it changes are
+// rewritten, those it returns false for are removed.
+func editAttributes(tag string, edit func(name string, value string) (string, bool)) string {
+	nameEnd := len(reTagName.FindString(tag))
+	attributes := reAttribute.ReplaceAllStringFunc(tag[nameEnd:], func(attribute string) string {
+		m := reAttribute.FindStringSubmatch(attribute)
+		value := m[3]
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+			value = value[1 : len(value)-1]
+		}
+		value = html.UnescapeString(value)
+		edited, keep := edit(strings.ToLower(m[2]), value)
+		switch {
+		case !keep:
+			return ""
+		case edited == value:
+			return attribute
+		}
+		return m[1] + m[2] + `="` + html.EscapeString(edited) + `"`
+	})
+	return tag[:nameEnd] + attributes
+}
+
+// tagAttribute returns the unescaped value of an attribute of a start tag.
+func tagAttribute(tag string, name string) (string, bool) {
+	var value string
+	found := false
+	editAttributes(tag, func(attr string, v string) (string, bool) {
+		if attr == name && !found {
+			value, found = v, true
+		}
+		return v, true
+	})
+	return value, found
+}
+
+// setAttribute sets an attribute of a start tag, adding it when missing.
+func setAttribute(tag string, name string, value string) string {
+	tag = removeAttribute(tag, name)
+	end := strings.LastIndex(tag, ">")
+	if strings.HasSuffix(tag[:end], "/") {
+		end--
+	}
+	return tag[:end] + " " + name + `="` + html.EscapeString(value) + `"` + tag[end:]
+}
+
+// removeAttribute removes an attribute from a start tag.
+func removeAttribute(tag string, name string) string {
+	return editAttributes(tag, func(attr string, value string) (string, bool) {
+		return value, attr != name
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportHTML(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html": `<html><head>
+<link rel="stylesheet" href="css/app.css?v=2" media="screen">
+<link rel="icon" href="/favicon.svg">
+<link rel="stylesheet" href="https://cdn.example.com/lib.css">
+<script src="js/app.js"></script>
+<script defer src="js/late.js"></script>
+<script type="module" src="js/main.js"></script>
+<script type="module" src="js/solo.js"></script>
+<script type="module">import "./js/util.js"</script>
+</head><body style="background: url('img/bg.png')">
+<img src="img/logo.png" srcset="img/logo.png 1x, img/big.png 2x" alt="Logo">
+<a href="other.html">Other</a>
+<img src="img/missing.png">
+</body></html>`,
+		"css/app.css":  `@import "base.css"; h1 { background: url(../img/logo.png) }`,
+		"css/base.css": `body { margin: 0 }`,
+		"js/app.js":    `document.write("</script>")`,
+		"js/late.js":   `console.log("late")`,
+		"js/main.js":   `import { log } from "./util.js"; log()`,
+		"js/solo.js":   `console.log("solo")`,
+		"js/util.js":   `export function log() {}`,
+		"favicon.svg":  `<svg xmlns="http://www.w3.org/2000/svg"></svg>`,
+		"img/bg.png":   "bg",
+		"img/logo.png": "logo",
+		"img/big.png":  strings.Repeat("x", 2048),
+		"other.html":   "<html></html>",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	exporter := newExporter(dir, nil, exportOptions{MaxInlineSize: 1024})
+	exported, err := exporter.exportHTML([]byte(files["index.html"]), "/index.html")
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	html := string(exported)
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	expected := []string{
+		`<style media="screen">@import url(data:text/css;base64,` + b64(`body { margin: 0 }`) + `); h1 { background: url(data:image/png;base64,` + b64("logo") + `) }</style>`,
+		`<link rel="icon" href="data:image/svg+xml;base64,` + b64(files["favicon.svg"]) + `">`,
+		`<link rel="stylesheet" href="https://cdn.example.com/lib.css">`,
+		`<script>document.write("<\/script>")</script>`,
+		`<script defer src="data:text/javascript;base64,` + b64(files["js/late.js"]) + `"></script>`,
+		`<body style="background: url(data:image/png;base64,` + b64("bg") + `)">`,
+		`srcset="data:image/png;base64,` + b64("logo") + ` 1x, img/big.png 2x"`,
+		`<script type="module" src="js/main.js"></script>`,
+		`<script type="module">console.log("solo")</script>`,
+		`<a href="other.html">`,
+		`<img src="img/missing.png">`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(html, e) {
+			t.Fatalf("Expected export to contain %s, got:\n%s", e, html)
+		}
+	}
+	if strings.Contains(html, "WebSocket") {
+		t.Fatalf("Expected no live reload snippet in the export, got:\n%s", html)
+	}
+
+	statuses := map[string]string{}
+	for _, a := range exporter.assets {
+		statuses[a.Ref] = a.Status + " " + a.Reason
+	}
+	for ref, status := range map[string]string{
+		"/img/big.png":                        exportKept + " " + exportTooLarge,
+		"https://cdn.example.com/lib.css":     exportKept + " " + exportRemote,
+		"/css/app.css":                        exportInlined + " ",
+		"/js/main.js":                         exportKept + " " + exportModule,
+		"inline module script in /index.html": exportKept + " " + exportModule,
+	} {
+		if statuses[ref] != status {
+			t.Fatalf("Expected %s to be reported as %q, got %q", ref, status, statuses[ref])
+		}
+	}
+	if !strings.HasPrefix(statuses["/img/missing.png"], exportMissing) {
+		t.Fatalf("Expected /img/missing.png to be reported missing, got %q", statuses["/img/missing.png"])
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for value, expected := range map[string]int64{"0": 0, "512": 512, "500k": 500 * 1024, "2M": 2 * 1024 * 1024, "64KB": 64 * 1024} {
+		if size, err := parseSize(value); err != nil || size != expected {
+			t.Fatalf("Expected %s to be %d bytes, got %d, %v", value, expected, size, err)
+		}
+	}
+	if _, err := parseSize("big"); err == nil {
+		t.Fatalf("Expected an error for an invalid size")
+	}
+}
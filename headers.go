@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// HeaderRule is a block of a _headers file, as used by Netlify and Cloudflare
+// Pages: a path pattern followed by indented headers applied to matching paths.
+//
+//	/assets/*
+//	  Cache-Control: no-store
+//	  ! Set-Cookie
+type HeaderRule struct {
+	Pattern string
+	Headers http.Header
+	// Detach lists headers removed from responses by this rule.
+	Detach []string
+	Line   int
+
+	re *regexp.Regexp
+}
+
+// parseHeaders parses the contents of a _headers file. Blank lines and lines
+// starting with # are ignored.
+func parseHeaders(data []byte) ([]HeaderRule, error) {
+	var rules []HeaderRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		indented := raw[0] == ' ' || raw[0] == '\t'
+		if !indented {
+			if !strings.HasPrefix(line, "/") {
+				return nil, fmt.Errorf("line %d: expected a path starting with /, got %q", lineNo, line)
+			}
+			rules = append(rules, HeaderRule{
+				Pattern: line,
+				Headers: http.Header{},
+				Line:    lineNo,
+				re:      compilePathGlob(line),
+			})
+			continue
+		}
+		if len(rules) == 0 {
+			return nil, fmt.Errorf("line %d: header %q outside of a path block", lineNo, line)
+		}
+		rule := &rules[len(rules)-1]
+		if name, ok := strings.CutPrefix(line, "!"); ok {
+			rule.Detach = append(rule.Detach, strings.TrimSpace(name))
+			continue
+		}
+		name, value, err := parseHeaderLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		rule.Headers.Add(name, value)
+	}
+	return rules, scanner.Err()
+}
+
+// parseHeaderLine parses a "Name: value" header.
+func parseHeaderLine(line string) (string, string, error) {
+	name, value, ok := strings.Cut(line, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", fmt.Errorf("invalid header %q, expected Name: value", line)
+	}
+	return textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(value), nil
+}
+
+// compilePathGlob turns a path pattern into a regular expression, where *
+// matches any characters and a :placeholder matches a single path segment.
+func compilePathGlob(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*':
+			b.WriteString(".*")
+		case c == ':' && i+1 < len(pattern) && isPlaceholderStart(pattern[i+1]):
+			for i+1 < len(pattern) && isPlaceholderChar(pattern[i+1]) {
+				i++
+			}
+			b.WriteString("[^/]+")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func isPlaceholderStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isPlaceholderChar(c byte) bool {
+	return isPlaceholderStart(c) || ('0' <= c && c <= '9')
+}
+
+// Match reports whether the rule applies to the URL path.
+func (rule HeaderRule) Match(urlPath string) bool {
+	return rule.re.MatchString(urlPath)
+}
+
+// headersHandler sets the headers given on the command line and those of the
+// matching _headers rules before passing requests to next, so they apply to
+// the injected index as well as to static files.
+func headersHandler(
+	rules *reloadingFile[[]HeaderRule],
+	static http.Header,
+	next http.Handler,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isInternalPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		for name, values := range static {
+			for _, value := range values {
+				h.Add(name, value)
+			}
+		}
+		for _, rule := range rules.Get() {
+			if !rule.Match(r.URL.Path) {
+				continue
+			}
+			for name, values := range rule.Headers {
+				for _, value := range values {
+					h.Add(name, value)
+				}
+			}
+			for _, name := range rule.Detach {
+				h.Del(name)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
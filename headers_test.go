@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestParseHeaders verifies parsing of path blocks, headers and detached headers.
+func TestParseHeaders(t *testing.T) {
+	rules, err := parseHeaders([]byte(`
+# comment
+/*
+  Cross-Origin-Opener-Policy: same-origin
+  cross-origin-embedder-policy: require-corp
+/sw/:version/*
+	Service-Worker-Allowed: /
+	! X-Frame-Options
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse headers: %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(rules))
+	}
+	if rules[0].Headers.Get("Cross-Origin-Embedder-Policy") != "require-corp" {
+		t.Errorf("Expected canonical header name, got %v", rules[0].Headers)
+	}
+	if len(rules[1].Detach) != 1 || rules[1].Detach[0] != "X-Frame-Options" || rules[1].Line != 6 {
+		t.Errorf("Expected detached header on rule at line 6, got %+v", rules[1])
+	}
+	if !rules[1].Match("/sw/v2/worker.js") || rules[1].Match("/sw/worker.js") {
+		t.Errorf("Unexpected placeholder matching for %s", rules[1].Pattern)
+	}
+
+	if _, err := parseHeaders([]byte("  X-Orphan: 1\n")); err == nil {
+		t.Errorf("Expected error for header outside of a path block")
+	}
+	if _, err := parseHeaders([]byte("/*\n  Not a header\n")); err == nil {
+		t.Errorf("Expected error for invalid header line")
+	}
+}
+
+// TestHeadersHandler verifies that flag and _headers headers apply to the index and static files.
+func TestHeadersHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	htmlPath := filepath.Join(tmpDir, "index.html")
+	os.WriteFile(htmlPath, []byte(`<html><body>Hello</body></html>`), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "app.js"), []byte("console.log('hi')"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "_headers"), []byte(`
+/*
+  Cross-Origin-Opener-Policy: same-origin
+/*.js
+  Access-Control-Allow-Origin: *
+  ! X-Debug
+`), 0644)
+
+	ts := httptest.NewServer(DevServer(htmlPath, Config{Headers: http.Header{"X-Debug": {"1"}}}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GET / failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Cross-Origin-Opener-Policy") != "same-origin" || resp.Header.Get("X-Debug") != "1" {
+		t.Fatalf("Expected custom headers on index, got %v", resp.Header)
+	}
+	if resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("Expected no CORS header on index, got %v", resp.Header)
+	}
+
+	resp, err = http.Get(ts.URL + "/app.js")
+	if err != nil {
+		t.Fatalf("GET /app.js failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Access-Control-Allow-Origin") != "*" || resp.Header.Get("Cross-Origin-Opener-Policy") != "same-origin" {
+		t.Fatalf("Expected custom headers on static file, got %v", resp.Header)
+	}
+	if resp.Header.Get("X-Debug") != "" {
+		t.Fatalf("Expected X-Debug to be detached, got %v", resp.Header)
+	}
+}
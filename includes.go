@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// reInclude matches the server side include directives dotdev processes,
+// <!--#include file="..." --> and <!--#include virtual="..." -->.
+var reInclude = regexp.MustCompile(`<!--#include\s+(file|virtual)\s*=\s*(?:"([^"]*)"|'([^']*)')\s*-->`)
+
+// includeError describes a directive whose partial cannot be included.
+type includeError struct {
+	// File and Line locate the directive, File relative to the root.
+	File    string
+	Line    int
+	Problem string
+}
+
+func (e *includeError) Error() string {
+	return fmt.Sprintf("%s line %d: %s", e.File, e.Line, e.Problem)
+}
+
+// hasIncludes reports whether the content has include directives.
+func hasIncludes(content []byte) bool {
+	return reInclude.Match(content)
+}
+
+// expandIncludes replaces the include directives of a document served from
+// the root with the content of the partials they name. A file path is
+// relative to the file with the directive, a virtual path is a URL resolved
+// like the server resolves it, from the root and the mounts. Partials can
+// include other partials. It returns the expanded content and the included
+// files, also when a partial is missing or includes itself.
+func expandIncludes(content []byte, file string, root string, mounts []Mount) ([]byte, []string, error) {
+	var included []string
+	expanded, err := expandIncludesOf(content, file, root, mounts, []string{file}, &included)
+	return expanded, included, err
+}
+
+func expandIncludesOf(content []byte, file string, root string, mounts []Mount, stack []string, included *[]string) ([]byte, error) {
+	matches := reInclude.FindAllSubmatchIndex(content, -1)
+	if matches == nil {
+		return content, nil
+	}
+	var out []byte
+	last := 0
+	for _, m := range matches {
+		var value string
+		if m[4] >= 0 {
+			value = string(content[m[4]:m[5]])
+		} else {
+			value = string(content[m[6]:m[7]])
+		}
+		fail := func(problem string) error {
+			return &includeError{File: displayPath(root, file), Line: lineAt(content, int64(m[0])), Problem: problem}
+		}
+
+		partial, ok := includeFile(file, root, mounts, string(content[m[2]:m[3]]), value)
+		if !ok {
+			return nil, fail(fmt.Sprintf("cannot include %q", value))
+		}
+		if !slices.Contains(*included, partial) {
+			*included = append(*included, partial)
+		}
+		if i := slices.Index(stack, partial); i >= 0 {
+			var cycle []string
+			for _, f := range slices.Concat(stack[i:], []string{partial}) {
+				cycle = append(cycle, displayPath(root, f))
+			}
+			return nil, fail(fmt.Sprintf("including %s creates a cycle: %s", value, strings.Join(cycle, " → ")))
+		}
+		data, err := os.ReadFile(partial)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fail(fmt.Sprintf("the partial %s does not exist", displayPath(root, partial)))
+			}
+			return nil, fail(err.Error())
+		}
+		data, err = expandIncludesOf(data, partial, root, mounts, append(stack, partial), included)
+		if err != nil {
+			return nil, err
+		}
+		out = append(append(out, content[last:m[0]]...), data...)
+		last = m[1]
+	}
+	return append(out, content[last:]...), nil
+}
+
+// includeFile returns the file a directive of the given kind refers to.
+func includeFile(file string, root string, mounts []Mount, kind string, value string) (string, bool) {
+	if kind == "file" {
+		// Like in Apache, a file path cannot leave the directory of the file.
+		if value == "" || filepath.IsAbs(value) || slices.Contains(strings.Split(filepath.ToSlash(value), "/"), "..") {
+			return "", false
+		}
+		return filepath.Join(filepath.Dir(file), filepath.FromSlash(value)), true
+	}
+	u, ok := localReference(documentURL(root, mounts, file), value)
+	// URLs of dotdev itself, such as the node_modules mounted for modules,
+	// are not files of the site.
+	if !ok || isInternalPath(u.Path) {
+		return "", false
+	}
+	return resolveURLPath(root, mounts, u.Path), true
+}
+
+// displayPath returns the path of a file relative to the root, when under it.
+func displayPath(root string, file string) string {
+	if rel, err := filepath.Rel(root, file); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"pages/index.html":             `<body><!--#include file="parts/header.html" --><main></main><!--#include virtual='/partials/footer.html'--></body>`,
+		"pages/parts/header.html":      `<header><!--#include file="nav.html" --></header>`,
+		"pages/parts/nav.html":         `<nav></nav>`,
+		"partials/footer.html":         `<footer><!--#include virtual="/ui/copyright.html" --></footer>`,
+		"shared/copyright.html":        `(c)`,
+		"loop/a.html":                  "<!--#include file=\"b.html\" -->",
+		"loop/b.html":                  "\n\n<!--#include file=\"a.html\" -->",
+		"missing.html":                 "<p>\n<!--#include file=\"partials/none.html\" -->",
+		"partials/absolute.html":       `<!--#include file="/etc/hosts" -->`,
+		"partials/parent.html":         `<!--#include file="nested/../../missing.html" -->`,
+		"partials/internal.html":       `<!--#include virtual="/__dotdev/node_modules/pkg/secret.html" -->`,
+		"node_modules/pkg/secret.html": `secret`,
+	})
+	mounts := []Mount{{Prefix: "/ui", Dir: filepath.Join(dir, "shared")}}
+
+	page := filepath.Join(dir, "pages", "index.html")
+	content, _ := readPage(page, dir)
+	content, included, err := expandIncludes(content, page, dir, mounts)
+	if err != nil {
+		t.Fatalf("Expected includes to expand, got %v", err)
+	}
+	expected := `<body><header><nav></nav></header><main></main><footer>(c)</footer></body>`
+	if string(content) != expected {
+		t.Fatalf("Expected %s, got %s", expected, content)
+	}
+	if len(included) != 4 || included[2] != filepath.Join(dir, "partials", "footer.html") || included[3] != filepath.Join(dir, "shared", "copyright.html") {
+		t.Fatalf("Expected the included files in order, got %v", included)
+	}
+
+	unknown := `<!--#echo var="DATE_LOCAL" --><!-- plain comment -->`
+	if content, _, _ := expandIncludes([]byte(unknown), page, dir, nil); string(content) != unknown {
+		t.Fatalf("Expected other comments to be kept, got %s", content)
+	}
+
+	errors := map[string]string{
+		"loop/a.html":            "loop/b.html line 3: including a.html creates a cycle: loop/a.html → loop/b.html → loop/a.html",
+		"missing.html":           "missing.html line 2: the partial partials/none.html does not exist",
+		"partials/absolute.html": `partials/absolute.html line 1: cannot include "/etc/hosts"`,
+		"partials/parent.html":   `partials/parent.html line 1: cannot include "nested/../../missing.html"`,
+		"partials/internal.html": `partials/internal.html line 1: cannot include "/__dotdev/node_modules/pkg/secret.html"`,
+	}
+	internal := []Mount{{Prefix: nodeModulesPrefix, Dir: filepath.Join(dir, "node_modules")}}
+	for name, expected := range errors {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		content, _ := readPage(file, dir)
+		_, included, err := expandIncludes(content, file, dir, internal)
+		if err == nil || err.Error() != expected {
+			t.Fatalf("Expected error %q for %s, got %v", expected, name, err)
+		}
+		if name == "missing.html" && (len(included) != 1 || !strings.HasSuffix(included[0], "none.html")) {
+			t.Fatalf("Expected the missing partial to be reported as included, got %v", included)
+		}
+	}
+}
+
+func TestServeIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"index.html":           `<html><body><!--#include file="partials/header.html" --></body></html>`,
+		"about/index.html":     `<html><body><!--#include virtual="/partials/header.html" --></body></html>`,
+		"plain.html":           `<html><body></body></html>`,
+		"broken.html":          `<html><body><!--#include file="partials/none.html" --></body></html>`,
+		"partials/header.html": `<header><link rel="stylesheet" href="/header.css"></header>`,
+		"header.css":           "",
+		"shared/page.html":     `<html><body><!--#include file="part.html" --></body></html>`,
+		"shared/part.html":     `<aside></aside>`,
+	})
+	entry := filepath.Join(dir, "index.html")
+	config := Config{Mounts: []Mount{{Prefix: "/ui", Dir: filepath.Join(dir, "shared")}}}
+
+	ts := httptest.NewServer(DevServer(entry, config))
+	defer ts.Close()
+	get := func(path string) (int, string) {
+		resp, err := ts.Client().Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := get("/ui/page.html"); status != 200 || !strings.Contains(body, "<aside>") || !strings.Contains(body, "new WebSocket") {
+		t.Fatalf("Expected pages under mounts to be rendered, got %d %s", status, body)
+	}
+	for _, path := range []string{"/", "/about/"} {
+		status, body := get(path)
+		if status != 200 || !strings.Contains(body, "<header>") || !strings.Contains(body, "new WebSocket") {
+			t.Fatalf("Expected %s to include the header and the live reload snippet, got %d %s", path, status, body)
+		}
+	}
+	if _, body := get("/plain.html"); body != "<html><body></body></html>" {
+		t.Fatalf("Expected pages without includes to be served as they are, got %s", body)
+	}
+	if status, body := get("/broken.html"); status != 500 || !strings.Contains(body, "the partial partials/none.html does not exist") {
+		t.Fatalf("Expected an error page for a missing partial, got %d %s", status, body)
+	}
+
+	files := strings.Join(buildDependencyGraph(entry, Config{}).Files(), "\n")
+	for _, expected := range []string{filepath.Join("partials", "header.html"), "header.css"} {
+		if !strings.Contains(files, expected) {
+			t.Fatalf("Expected %s to be watched, got %s", expected, files)
+		}
+	}
+}
@@ -3,19 +3,26 @@ package main
 import (
 	"embed"
 	"fmt"
+	"html"
 	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
 //go:embed assets/*
 var assetsFs embed.FS
 
+// indexHandler returns a function serving a page with the live reload
+// snippet: the entry file or another page dotdev renders. The content is read
+// from the page when it is nil.
 func indexHandler(
 	htmlFile string,
-) http.HandlerFunc {
+	config Config,
+) func(w http.ResponseWriter, r *http.Request, page string, content []byte) {
 	liveReloadScriptBytes, err := fs.ReadFile(assetsFs, "assets/live-reload.js")
 	if err != nil {
 		fmt.Printf("%sError reading live-reload.js. Live reload will not work.%s\n", Clr.Red, Clr.Reset)
@@ -26,48 +33,91 @@ func indexHandler(
 		fmt.Printf("%sError reading error.html. Error page will not work.%s\n", Clr.Red, Clr.Reset)
 	}
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		ServerState.NoRequests += 1
-		notifyServerStateUpdate()
-		if r.URL.Path != "/" {
+	root := filepath.Dir(htmlFile)
+
+	return func(w http.ResponseWriter, r *http.Request, page string, content []byte) {
+		var err error
+		if content == nil {
+			content, err = readPage(page, root)
+		}
+		if err != nil {
+			log.Printf("Error reading file: %v\n", err)
 			handleError(
-				w, errorResponseBytes, http.StatusNotFound,
-				"Not Found",
-				fmt.Sprintf("The page %s does not exist.", r.URL.Path),
+				w, errorResponseBytes, http.StatusInternalServerError,
+				"Unexpected error",
+				fmt.Sprintf("Error reading file: %v", err),
 			)
 			return
 		}
 
-		content, err := os.ReadFile(htmlFile)
+		content, _, err = expandIncludes(content, page, root, config.Mounts)
 		if err != nil {
-			log.Printf("Error reading file: %v\n", err)
 			handleError(
 				w, errorResponseBytes, http.StatusInternalServerError,
-				"Unexpected error",
-				fmt.Sprintf("Error reading file: %v", err),
+				"Include failed",
+				err.Error(),
 			)
 			return
 		}
+		if config.Template && !isMarkdownFile(page) {
+			content, err = renderTemplate(content, page, root)
+			if err != nil {
+				handleError(
+					w, errorResponseBytes, http.StatusInternalServerError,
+					"Template failed",
+					err.Error(),
+				)
+				return
+			}
+		}
 
-		htmlContent := string(content)
+		if config.ResolveModules {
+			content = injectImportMap(content, pageImportMap(root, page, config))
+		}
 		snippet := fmt.Sprintf("<script type=\"text/javascript\">\n%s\n</script>", liveReloadScript)
-		if idx := strings.LastIndex(htmlContent, "</body>"); idx != -1 {
-			htmlContent = htmlContent[:idx] + "\n" + snippet + "\n" + htmlContent[idx:]
-		} else {
-			htmlContent += snippet
+		htmlContent, charset := injectSnippet(content, snippet)
+		w.Header().Set("Content-Type", htmlContentType(charset))
+		markInjected(w)
+		w.Write(htmlContent)
+	}
+}
+
+// renderedPage returns the file of a page besides the entry file that is
+// rendered rather than served as is: a Markdown file, or an HTML file with
+// include directives or, with --template, any HTML file. The content of an
+// HTML file read to look for directives is returned with it. It returns an
+// empty string for other URL paths.
+func renderedPage(root string, urlPath string, config Config) (string, []byte) {
+	file := resolveURLPath(root, config.Mounts, urlPath)
+	if strings.HasSuffix(urlPath, "/") {
+		file = filepath.Join(file, "index.html")
+	}
+	if isMarkdownFile(file) && fileExists(file) {
+		return file, nil
+	}
+	if isHTMLFile(file) && config.Template && fileExists(file) {
+		return file, nil
+	}
+	if isHTMLFile(file) {
+		if content, err := os.ReadFile(file); err == nil && hasIncludes(content) {
+			return file, content
 		}
-		w.Write([]byte(htmlContent))
 	}
+	return "", nil
 }
 
 func handleError(w http.ResponseWriter, errorResponseBytes []byte, statusCode int, message string, description string) {
-	ServerState.NoErrors += 1
-	notifyServerStateUpdate()
+	ServerState.IncErrors()
+	ServerState.RecordEvent("error", fmt.Sprintf("%d %s: %s", statusCode, message, description),
+		slog.Int("status", statusCode),
+		slog.String("error", message),
+		slog.String("description", description),
+	)
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(statusCode)
 	materializedErorrData := strings.ReplaceAll(string(errorResponseBytes), "{{dotdev::error.statusCode}}", fmt.Sprintf("%d", statusCode))
-	materializedErorrData = strings.ReplaceAll(materializedErorrData, "{{dotdev::error.message}}", message)
-	materializedErorrData = strings.ReplaceAll(materializedErorrData, "{{dotdev::error.description}}", description)
+	materializedErorrData = strings.ReplaceAll(materializedErorrData, "{{dotdev::error.message}}", html.EscapeString(message))
+	materializedErorrData = strings.ReplaceAll(materializedErorrData, "{{dotdev::error.description}}", html.EscapeString(description))
 	materializedErorrData = strings.ReplaceAll(materializedErorrData, "{{dotdev::version}}", Version)
 	w.Write([]byte(materializedErorrData))
 }
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// PortAuto is the --port value that picks the next free port.
+const PortAuto = "auto"
+
+// portFallbackAttempts is the number of consecutive ports tried with --port
+// auto before letting the operating system pick a free one.
+const portFallbackAttempts = 20
+
+// portFlag is the --port flag, a port number or "auto".
+type portFlag struct {
+	port int
+	auto bool
+}
+
+func (f *portFlag) String() string {
+	if f.auto {
+		return PortAuto
+	}
+	return strconv.Itoa(f.port)
+}
+
+func (f *portFlag) Set(value string) error {
+	if value == PortAuto {
+		f.auto = true
+		return nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 0 || port > 65535 {
+		return fmt.Errorf("invalid port %q, expected a number up to 65535 or %s", value, PortAuto)
+	}
+	f.port = port
+	f.auto = false
+	return nil
+}
+
+// serverListener is a listener with the URLs it is reachable at.
+type serverListener struct {
+	net.Listener
+	urls    []string
+	lanURLs []string
+}
+
+func newServerListener(listener net.Listener, host string) serverListener {
+	switch addr := listener.Addr().(type) {
+	case *net.UnixAddr:
+		return serverListener{Listener: listener, urls: []string{"unix:" + addr.Name}}
+	case *net.TCPAddr:
+		if host == "" && !addr.IP.IsUnspecified() {
+			host = addr.IP.String()
+		}
+		urls, lanURLs := serverURLs(host, addr.Port)
+		return serverListener{Listener: listener, urls: urls, lanURLs: lanURLs}
+	}
+	return serverListener{Listener: listener, urls: []string{listener.Addr().String()}}
+}
+
+// openListeners opens the listeners of the server: those inherited through
+// systemd socket activation and those given with --listen. Without either,
+// it binds the configured host and port.
+func openListeners(config Config) ([]serverListener, error) {
+	inherited, err := systemdListeners()
+	if err != nil {
+		return nil, err
+	}
+	var listeners []serverListener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+	for _, l := range inherited {
+		listeners = append(listeners, newServerListener(l, ""))
+	}
+	for _, addr := range config.Listen {
+		network, address, err := parseListenAddress(addr)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		l, err := listenAddress(network, address)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		host, _, _ := net.SplitHostPort(address)
+		listeners = append(listeners, newServerListener(l, host))
+	}
+	if len(listeners) == 0 {
+		l, err := listenTCP(config)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, newServerListener(l, config.Host))
+	}
+	return listeners, nil
+}
+
+// parseListenAddress parses a --listen address: unix:PATH for a Unix socket,
+// or HOST:PORT, optionally prefixed with tcp:, for TCP.
+func parseListenAddress(addr string) (network string, address string, err error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if path == "" {
+			return "", "", fmt.Errorf("invalid listen address %q, expected unix:PATH", addr)
+		}
+		return "unix", path, nil
+	}
+	addr = strings.TrimPrefix(addr, "tcp:")
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", "", fmt.Errorf("invalid listen address %q, expected unix:PATH or HOST:PORT", addr)
+	}
+	return "tcp", addr, nil
+}
+
+// listenAddress listens on a --listen address. A Unix socket left behind by a
+// server that is no longer running is replaced.
+func listenAddress(network string, address string) (net.Listener, error) {
+	if network == "unix" {
+		if info, err := os.Stat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if conn, err := net.Dial("unix", address); err == nil {
+				conn.Close()
+				return nil, fmt.Errorf("socket %s is already in use by a running server", address)
+			}
+			os.Remove(address)
+		}
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		if network == "tcp" {
+			host, portStr, _ := net.SplitHostPort(address)
+			port, _ := strconv.Atoi(portStr)
+			return nil, bindError(err, host, port)
+		}
+		return nil, fmt.Errorf("cannot listen on %s:%s: %w", network, address, err)
+	}
+	return listener, nil
+}
+
+// systemdListenFdsStart is the first file descriptor passed by systemd.
+const systemdListenFdsStart = 3
+
+// systemdListeners returns the listeners passed by systemd socket activation
+// through LISTEN_FDS and LISTEN_PID. The variables are unset, so child
+// processes do not pick them up.
+func systemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	var listeners []net.Listener
+	for i := 0; i < count; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(systemdListenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(systemdListenFdsStart+i), name)
+		listener, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("cannot use socket %s passed by systemd: %w", name, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// listenTCP binds the configured host and port. With AutoPort, ports taken by
+// other processes are skipped, starting at the configured port.
+func listenTCP(config Config) (net.Listener, error) {
+	port := config.Port
+	for attempt := 0; ; attempt++ {
+		listener, err := net.Listen("tcp", net.JoinHostPort(config.Host, strconv.Itoa(port)))
+		if err == nil {
+			if port != config.Port {
+				ServerState.RecordEvent("port", fmt.Sprintf("Port %d is in use, using port %d", config.Port, listenerPort(listener)))
+			}
+			return listener, nil
+		}
+		if !config.AutoPort || !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, bindError(err, config.Host, port)
+		}
+		if port == 0 {
+			return nil, bindError(err, config.Host, config.Port)
+		}
+		port++
+		if attempt+1 == portFallbackAttempts || port > 65535 {
+			port = 0
+		}
+	}
+}
+
+// listenerPort returns the TCP port a listener is bound to.
+func listenerPort(listener net.Listener) int {
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
+}
+
+// bindError explains a failure to bind the port and suggests alternatives.
+func bindError(err error, host string, port int) error {
+	switch {
+	case errors.Is(err, syscall.EADDRINUSE):
+		return fmt.Errorf("port %d on %s is already in use, probably by another dotdev instance. "+
+			"Stop it, choose another port with --port %d, or use --port auto to pick the next free port", port, host, port+1)
+	case errors.Is(err, syscall.EACCES):
+		return fmt.Errorf("permission denied to bind port %d on %s. "+
+			"Ports below 1024 usually need elevated privileges; use a higher port such as --port %d, or --port auto", port, host, DEFAULT_PORT)
+	}
+	return fmt.Errorf("cannot listen on %s: %w", net.JoinHostPort(host, strconv.Itoa(port)), err)
+}
+
+// writeURLFile writes the server URL to the file given with --url-file, so
+// scripts can find a server started with --port auto.
+func writeURLFile(path string, url string) error {
+	if path == "" {
+		return nil
+	}
+	return os.WriteFile(path, []byte(url+"\n"), 0644)
+}
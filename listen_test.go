@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestListenTCPAutoPort verifies that a taken port is skipped with AutoPort
+// and reported with a readable message without it.
+func TestListenTCPAutoPort(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer taken.Close()
+	port := listenerPort(taken)
+
+	_, err = listenTCP(Config{Host: "127.0.0.1", Port: port})
+	if err == nil || !strings.Contains(err.Error(), "already in use") || !strings.Contains(err.Error(), "--port auto") {
+		t.Fatalf("Expected port in use error suggesting --port auto, got %v", err)
+	}
+
+	listener, err := listenTCP(Config{Host: "127.0.0.1", Port: port, AutoPort: true})
+	if err != nil {
+		t.Fatalf("Expected a free port, got %v", err)
+	}
+	defer listener.Close()
+	if listenerPort(listener) == port {
+		t.Fatalf("Expected a port other than %d", port)
+	}
+}
+
+func TestPortFlag(t *testing.T) {
+	f := &portFlag{port: DEFAULT_PORT}
+	if err := f.Set("auto"); err != nil || !f.auto || f.port != DEFAULT_PORT {
+		t.Fatalf("Expected auto port starting at %d, got %+v, %v", DEFAULT_PORT, f, err)
+	}
+	if err := f.Set("8080"); err != nil || f.auto || f.port != 8080 {
+		t.Fatalf("Expected port 8080, got %+v, %v", f, err)
+	}
+	for _, value := range []string{"http", "-1", "70000"} {
+		if err := f.Set(value); err == nil {
+			t.Fatalf("Expected error for port %q", value)
+		}
+	}
+}
+
+func TestWriteURLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "url")
+	if err := writeURLFile(path, "http://127.0.0.1:4775"); err != nil {
+		t.Fatalf("Failed to write URL file: %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "http://127.0.0.1:4775\n" {
+		t.Fatalf("Expected URL in file, got %q", content)
+	}
+}
+
+func TestParseListenAddress(t *testing.T) {
+	tests := []struct {
+		addr, network, address string
+	}{
+		{"unix:/run/user/1000/dotdev.sock", "unix", "/run/user/1000/dotdev.sock"},
+		{"127.0.0.1:4774", "tcp", "127.0.0.1:4774"},
+		{"tcp:[::1]:4774", "tcp", "[::1]:4774"},
+	}
+	for _, tt := range tests {
+		network, address, err := parseListenAddress(tt.addr)
+		if err != nil || network != tt.network || address != tt.address {
+			t.Fatalf("Expected %s %s for %q, got %s %s %v", tt.network, tt.address, tt.addr, network, address, err)
+		}
+	}
+	for _, addr := range []string{"unix:", "localhost", "/tmp/dotdev.sock"} {
+		if _, _, err := parseListenAddress(addr); err == nil {
+			t.Fatalf("Expected error for %q", addr)
+		}
+	}
+}
+
+// TestOpenListeners verifies serving on a Unix socket and a TCP address at once.
+func TestOpenListeners(t *testing.T) {
+	tmpDir := t.TempDir()
+	htmlPath := filepath.Join(tmpDir, "index.html")
+	os.WriteFile(htmlPath, []byte(`<html><body>Hello</body></html>`), 0644)
+	socketPath := filepath.Join(tmpDir, "dotdev.sock")
+
+	listeners, err := openListeners(Config{Listen: []string{"unix:" + socketPath, "127.0.0.1:0"}})
+	if err != nil {
+		t.Fatalf("Failed to open listeners: %v", err)
+	}
+	if len(listeners) != 2 || listeners[0].urls[0] != "unix:"+socketPath || !strings.HasPrefix(listeners[1].urls[0], "http://127.0.0.1:") {
+		t.Fatalf("Unexpected listeners: %+v", listeners)
+	}
+	server := &http.Server{Handler: DevServer(htmlPath, Config{})}
+	for _, l := range listeners {
+		go server.Serve(l)
+	}
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	resp, err := client.Get("http://dotdev/")
+	if err != nil {
+		t.Fatalf("GET over the Unix socket failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "Hello") {
+		t.Fatalf("Expected the served file over the Unix socket, got %s", body)
+	}
+	getHtmlContent(t, listeners[1].urls[0]+"/")
+
+	if _, err := openListeners(Config{Listen: []string{"unix:" + socketPath}}); err == nil {
+		t.Fatalf("Expected error for a socket in use")
+	}
+}
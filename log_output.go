@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+const (
+	LogFormatPretty = "pretty"
+	LogFormatPlain  = "plain"
+	LogFormatJSON   = "json"
+)
+
+// resolveLogFormat validates the requested log format. Without one, pretty
+// output is used on a terminal and plain output everywhere else, such as in
+// CI logs, files or docker logs.
+func resolveLogFormat(format string) (string, error) {
+	switch format {
+	case "":
+		if isTerminal(os.Stderr) {
+			return LogFormatPretty, nil
+		}
+		return LogFormatPlain, nil
+	case LogFormatPretty, LogFormatPlain, LogFormatJSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("invalid log format %q, expected %s, %s or %s", format, LogFormatPretty, LogFormatPlain, LogFormatJSON)
+}
+
+// setupColors disables colored output when the NO_COLOR environment variable
+// is set or stderr is not a terminal.
+func setupColors() {
+	if os.Getenv("NO_COLOR") != "" || !isTerminal(os.Stderr) {
+		Clr = Colors{}
+	}
+}
+
+// setupLogging routes the standard logger through a JSON handler in json
+// mode, so every log line is a structured event, and logs the events of the
+// server state in the plain and json formats.
+func setupLogging(config Config) {
+	if config.LogFormat == LogFormatJSON {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	}
+	ServerState.SetEventLog(eventLogger(config, os.Stderr))
+}
+
+// monitorServerState renders the server state on a terminal in the pretty
+// format. The other formats log every event as it is recorded instead.
+func monitorServerState(config Config) {
+	if config.LogFormat == LogFormatPretty && !config.Quiet {
+		monitorPretty(config.Verbose)
+	}
+}
+
+// eventLogger returns a function writing events to w in the configured
+// format, or nil for the pretty format. In quiet mode, only the server URLs
+// and errors are logged.
+func eventLogger(config Config, w io.Writer) func(Event) {
+	var logEvent func(w io.Writer, e Event)
+	switch {
+	case config.LogFormat == LogFormatJSON:
+		handler := slog.NewJSONHandler(w, nil)
+		logEvent = func(_ io.Writer, e Event) { logEventJSON(handler, e) }
+	case config.Quiet:
+		logEvent = logEventQuiet
+	case config.LogFormat == LogFormatPlain:
+		logEvent = logEventPlain
+	default:
+		return nil
+	}
+	return func(e Event) {
+		if config.Quiet && e.Kind != "error" && e.Kind != "serving" {
+			return
+		}
+		logEvent(w, e)
+	}
+}
+
+// eventAttr returns the value of an attribute of the event.
+func eventAttr(e Event, key string) slog.Value {
+	for _, attr := range e.Attrs {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return slog.Value{}
+}
+
+func logEventPlain(w io.Writer, e Event) {
+	if e.Kind == "serving" {
+		fmt.Fprintln(w, e.Message)
+		return
+	}
+	fmt.Fprintf(w, "%s %-10s %s\n", e.Time.Format("2006-01-02T15:04:05"), e.Kind, e.Message)
+}
+
+func logEventQuiet(w io.Writer, e Event) {
+	if e.Kind == "serving" {
+		urls, _ := eventAttr(e, "urls").Any().([]string)
+		for _, url := range urls {
+			fmt.Fprintln(w, url)
+		}
+		return
+	}
+	logEventPlain(w, e)
+}
+
+func logEventJSON(handler slog.Handler, e Event) {
+	level := slog.LevelInfo
+	if status := eventStatus(e); e.Kind == "error" || status >= 500 {
+		level = slog.LevelError
+	} else if status >= 400 || e.Kind == "warning" {
+		level = slog.LevelWarn
+	}
+	message := e.Message
+	if e.Kind == "serving" {
+		message = "serving"
+	}
+	// The record keeps the time at which the event happened.
+	record := slog.NewRecord(e.Time, level, message, 0)
+	record.AddAttrs(slog.String("event", e.Kind))
+	record.AddAttrs(e.Attrs...)
+	handler.Handle(context.Background(), record)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestResolveLogFormat(t *testing.T) {
+	for _, format := range []string{LogFormatPretty, LogFormatPlain, LogFormatJSON} {
+		if resolved, err := resolveLogFormat(format); err != nil || resolved != format {
+			t.Fatalf("Expected %s to be accepted, got %q, %v", format, resolved, err)
+		}
+	}
+	if _, err := resolveLogFormat("xml"); err == nil || !strings.Contains(err.Error(), `invalid log format "xml"`) {
+		t.Fatalf("Expected an error for an unknown format, got %v", err)
+	}
+}
+
+func TestEventLoggerLogsEveryEvent(t *testing.T) {
+	store := NewStateStore()
+	var out bytes.Buffer
+	store.SetEventLog(eventLogger(Config{LogFormat: LogFormatPlain}, &out))
+
+	// More events than the state keeps, recorded faster than snapshots are
+	// published.
+	n := maxEvents*2 + 1
+	for i := 0; i < n; i++ {
+		store.RecordEvent("request", fmt.Sprintf("GET /%d 200", i), slog.Int("status", 200))
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != n {
+		t.Fatalf("Expected %d logged events, got %d", n, len(lines))
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, fmt.Sprintf(" request    GET /%d 200", i)) {
+			t.Fatalf("Expected event %d in order, got %q", i, line)
+		}
+	}
+}
+
+func TestEventLoggerJSON(t *testing.T) {
+	store := NewStateStore()
+	var out bytes.Buffer
+	store.SetEventLog(eventLogger(Config{LogFormat: LogFormatJSON}, &out))
+	store.RecordEvent("serving", "dotdev serving index.html from . on http://127.0.0.1:4774",
+		slog.String("file", "index.html"), slog.String("dir", "."), slog.Any("urls", []string{"http://127.0.0.1:4774"}))
+	store.RecordEvent("request", "GET /app.js 404", slog.String("path", "/app.js"), slog.Int("status", 404))
+	store.RecordEvent("error", "500 Unexpected error")
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected a JSON record per line, got %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	if r := records[0]; r["msg"] != "serving" || r["event"] != "serving" || fmt.Sprint(r["urls"]) != "[http://127.0.0.1:4774]" {
+		t.Fatalf("Expected a serving record with the URLs, got %v", r)
+	}
+	if r := records[1]; r["level"] != "WARN" || r["event"] != "request" || r["path"] != "/app.js" || r["status"] != float64(404) {
+		t.Fatalf("Expected a warning for a 404 request, got %v", r)
+	}
+	if r := records[2]; r["level"] != "ERROR" {
+		t.Fatalf("Expected errors to be logged at the error level, got %v", r)
+	}
+}
+
+func TestEventLoggerQuiet(t *testing.T) {
+	store := NewStateStore()
+	var out bytes.Buffer
+	store.SetEventLog(eventLogger(Config{LogFormat: LogFormatPlain, Quiet: true}, &out))
+	store.RecordEvent("serving", "dotdev serving index.html", slog.Any("urls", []string{"http://127.0.0.1:4774", "http://[::1]:4774"}))
+	store.RecordEvent("request", "GET / 200", slog.Int("status", 200))
+	store.RecordEvent("error", "404 Not Found")
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 || lines[0] != "http://127.0.0.1:4774" || lines[1] != "http://[::1]:4774" || !strings.HasSuffix(lines[2], "error      404 Not Found") {
+		t.Fatalf("Expected only the URLs and errors, got %q", lines)
+	}
+
+	if eventLogger(Config{LogFormat: LogFormatPretty}, &out) != nil {
+		t.Fatalf("Expected no event log for the pretty format")
+	}
+}
@@ -2,14 +2,16 @@ package main
 
 import (
 	"embed"
-	"flag"
 	"fmt"
 	"io/fs"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 //go:embed version.txt
@@ -30,81 +32,98 @@ func init() {
 }
 
 func main() {
-	args := os.Args[1:]
-	action := ""
-	serveFile := ""
-	if len(args) < 1 {
-		log.Printf("Please provide a file to watch\n")
-		log.Printf("Usage: dotdev <file-to-watch> [--host <host>] [--port <port>]\n")
-		action = "help"
-	} else if args[0] == "help" || args[0] == "--help" || args[0] == "-h" {
-		action = "help"
-	} else if args[0] == "version" || args[0] == "--version" || args[0] == "-v" {
-		action = "version"
-	} else {
-		serveFile = os.Args[1]
-		action = "serve"
-		args = args[1:]
-	}
-
-	switch action {
-
-	case "serve":
-		defaultPort, err := strconv.Atoi(os.Getenv("PORT"))
-		if err != nil {
-			defaultPort = DEFAULT_PORT
-		}
-		defaultHost := os.Getenv("HOST")
-		if defaultHost == "" {
-			defaultHost = DEFAULT_HOST
-		}
-		serveFileParentDir := filepath.Dir(serveFile)
-		if _, err := os.Stat(serveFile); err != nil {
-			log.Printf("Serve file not found: %s\n", serveFile)
-			log.Fatal(err)
-		}
-		go monitorServerState()
-		ServerState.ServeFsDir = serveFileParentDir
-		notifyServerStateUpdate()
-		configFlagSet := flag.NewFlagSet("dotdev", flag.ContinueOnError)
-		host := configFlagSet.String("host", defaultHost, "Host of the dev server")
-		port := configFlagSet.Int("port", defaultPort, "Port of the dev server")
-		configFlagSet.Parse(args)
-		StartDevServer(*host, *port, serveFile)
-		os.Exit(0)
-
-	case "help":
-		printHelp()
-		os.Exit(0)
-
-	case "version":
-		fmt.Printf("%s", Version)
-		os.Exit(0)
-
-	default:
-		printHelp()
-		log.Printf("Unknown action: %s\n", action)
-		os.Exit(1)
+	setupColors()
+	os.Exit(runCLI(os.Args[1:]))
+}
 
+// runServe serves the file given as the argument until dotdev is stopped.
+func runServe(args cliArgs) int {
+	serveFile := args.Positional[0]
+	serveFileParentDir := filepath.Dir(serveFile)
+	if _, err := os.Stat(serveFile); err != nil {
+		log.Printf("Serve file not found: %s\n", serveFile)
+		log.Print(err)
+		return exitError
+	}
+	config, configFile, err := resolveConfig(serveFile, args.Settings)
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	config = withNodeModules(config, serveFileParentDir)
+	config.LogFormat, err = resolveLogFormat(config.LogFormat)
+	if err != nil {
+		log.Print(err)
+		return exitError
 	}
+	accessLog, err := openAccessLog(config.AccessLog, config.AccessLogFormat)
+	if err != nil {
+		log.Printf("Error opening access log: %v\n", err)
+		return exitError
+	}
+	defer restoreTerminalOnPanic()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer restoreTerminalOnPanic()
+		<-signals
+		stopServer()
+		// A second signal skips waiting for the graceful shutdown.
+		<-signals
+		exitGracefully(1)
+	}()
+	setupLogging(config)
+	if configFile != "" {
+		ServerState.RecordEvent("config", "Using "+configFile, slog.String("file", configFile))
+	}
+	monitorDone := make(chan struct{})
+	go func() {
+		defer restoreTerminalOnPanic()
+		monitorServerState(config)
+		close(monitorDone)
+	}()
+	if config.LogFormat == LogFormatPretty && !config.Quiet {
+		startTerminalControls()
+	}
+	ServerState.Update(func(state *State) {
+		state.ServeFsDir = serveFileParentDir
+	})
+	StartDevServer(serverContext, serveFile, config, accessLog)
+	if accessLog != nil {
+		accessLog.Close()
+	}
+	// Let the log report the shutdown before exiting.
+	ServerState.Close()
+	select {
+	case <-monitorDone:
+	case <-time.After(time.Second):
+	}
+	restoreTerminal()
+	return exitOK
 }
 
-func printHelp() {
-	fmt.Fprintf(os.Stderr, "%sdotdev %sv%s%s\n", Clr.Bold, Clr.Neutral, Version, Clr.Reset)
-	fmt.Fprintf(os.Stderr, "    Simple HTTP server with live reload\n\n")
-	fmt.Fprintf(os.Stderr, "%sUSAGE:%s\n", Clr.Bold, Clr.Reset)
-	fmt.Fprintf(os.Stderr, "    dotdev <file> [options]\n")
-	fmt.Fprintln(os.Stderr)
-	fmt.Fprintf(os.Stderr, "    %sOPTIONS%s:\n", Clr.Underline, Clr.Reset)
-	fmt.Fprintf(os.Stderr, "    %s--port <PORT>%s\n", Clr.Bold, Clr.Reset)
-	fmt.Fprintf(os.Stderr, "        Port of the dev server\n")
-	fmt.Fprintf(os.Stderr, "    %s--host <HOST>%s\n", Clr.Bold, Clr.Reset)
-	fmt.Fprintf(os.Stderr, "        Host of the dev server\n")
-	fmt.Fprintln(os.Stderr)
-	fmt.Fprintf(os.Stderr, "%sEXAMPLE%s:\n", Clr.Bold, Clr.Reset)
-	fmt.Fprintf(os.Stderr, "echo \"<html><body>Hello World</body></html>\" > ./index.html\n")
-	fmt.Fprintf(os.Stderr, "dotdev ./index.html --host localhost --port 4774\n")
-	fmt.Fprintln(os.Stderr)
+// runConfig prints the configuration resolved for the file given as the
+// argument, or for index.html in the working directory.
+func runConfig(args cliArgs) int {
+	serveFile := "index.html"
+	if len(args.Positional) > 0 {
+		serveFile = args.Positional[0]
+	}
+	config, configFile, err := resolveConfig(serveFile, args.Settings)
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	if configFile != "" {
+		fmt.Fprintf(os.Stderr, "%sUsing %s%s\n", Clr.Neutral, configFile, Clr.Reset)
+	} else {
+		fmt.Fprintf(os.Stderr, "%sNo config file found%s\n", Clr.Neutral, Clr.Reset)
+	}
+	if err := writeConfig(os.Stdout, config); err != nil {
+		log.Print(err)
+		return exitError
+	}
+	return exitOK
 }
 
 type Colors struct {
@@ -0,0 +1,796 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// markdownLayoutFile is the name of a layout next to the served file that
+// replaces the embedded assets/markdown.html.
+const markdownLayoutFile = "_markdown.html"
+
+// isMarkdownFile reports whether the file or URL path is a Markdown document.
+func isMarkdownFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// readPage returns the HTML of a served page, rendering Markdown files into
+// the layout. Other files are returned as they are.
+func readPage(file string, root string) ([]byte, error) {
+	if !isMarkdownFile(file) {
+		return os.ReadFile(file)
+	}
+	return renderMarkdownPage(file, root)
+}
+
+// renderMarkdownPage renders a Markdown file into the _markdown.html layout of
+// the root directory, or the embedded one. The layout receives the rendered
+// document as {{dotdev::content}} and its first heading as {{dotdev::title}}.
+func renderMarkdownPage(file string, root string) ([]byte, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := os.ReadFile(filepath.Join(root, markdownLayoutFile))
+	if err != nil {
+		layout, err = fs.ReadFile(assetsFs, "assets/markdown.html")
+		if err != nil {
+			return nil, err
+		}
+	}
+	doc := renderMarkdown(source)
+	title := doc.title
+	if title == "" {
+		title = filepath.Base(file)
+	}
+	page := strings.ReplaceAll(string(layout), "{{dotdev::title}}", html.EscapeString(title))
+	page = strings.ReplaceAll(page, "{{dotdev::content}}", doc.html)
+	return []byte(page), nil
+}
+
+var (
+	reMarkdownFence     = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^`\\s]*)")
+	reMarkdownATX       = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	reMarkdownHR        = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	reMarkdownSetext1   = regexp.MustCompile(`^ {0,3}=+[ \t]*$`)
+	reMarkdownSetext2   = regexp.MustCompile(`^ {0,3}-+[ \t]*$`)
+	reMarkdownQuote     = regexp.MustCompile(`^ {0,3}> ?`)
+	reMarkdownListItem  = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])([ \t]+|$)`)
+	reMarkdownHTML      = regexp.MustCompile(`^ {0,3}<(?:/?[a-zA-Z][a-zA-Z0-9-]*(?:[\s/>]|$)|!--)`)
+	reMarkdownTableSep  = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	reMarkdownLinkDef   = regexp.MustCompile(`^ {0,3}\[([^\]]+)\]:[ \t]*(?:<([^>]*)>|([^\s<]\S*))(?:[ \t]+(?:"([^"]*)"|'([^']*)'|\(([^)]*)\)))?[ \t]*$`)
+	reMarkdownTask      = regexp.MustCompile(`^\[([ xX])\][ \t]+`)
+	reMarkdownHardBreak = regexp.MustCompile(`(?: {2,}|\\)\n`)
+	reMarkdownStrong    = regexp.MustCompile(`\*\*([^\s*](?:[\s\S]*?[^\s*])?)\*\*|\b__([^\s_](?:[\s\S]*?[^\s_])?)__\b`)
+	reMarkdownEm        = regexp.MustCompile(`\*([^\s*](?:[\s\S]*?[^\s*])?)\*|\b_([^\s_](?:[\s\S]*?[^\s_])?)_\b`)
+	reMarkdownStrike    = regexp.MustCompile(`~~([^\s~](?:[\s\S]*?[^\s~])?)~~`)
+	reMarkdownURL       = regexp.MustCompile(`\bhttps?://[^\s<\x00]*[^\s<\x00.,:;"')\]]`)
+	reMarkdownInlineTag = regexp.MustCompile(`^<(?:/?[a-zA-Z][a-zA-Z0-9-]*(?:\s+[a-zA-Z_:][a-zA-Z0-9_.:-]*(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*/?>|!--[\s\S]*?-->)`)
+	reMarkdownAutolink  = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^\s<>]*|[a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*)>`)
+	reMarkdownTags      = regexp.MustCompile(`<[^>]*>`)
+	reMarkdownEntity    = regexp.MustCompile(`&amp;(?:[a-zA-Z][a-zA-Z0-9]{1,31}|#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6});`)
+)
+
+// markdownDocument is a rendered Markdown document.
+type markdownDocument struct {
+	html  string
+	title string
+}
+
+// markdownLink is a link reference definition, [label]: url "title".
+type markdownLink struct {
+	url   string
+	title string
+}
+
+// markdownRenderer renders a subset of CommonMark with GitHub extensions:
+// ATX and setext headings, paragraphs, emphasis, code spans and fences,
+// block quotes, nested lists and task lists, tables, links, reference links,
+// images, autolinks, thematic breaks and raw HTML. Headings get ids, so
+// #fragment links work.
+type markdownRenderer struct {
+	links map[string]markdownLink
+	slugs map[string]int
+	title string
+}
+
+// renderMarkdown converts a Markdown document to HTML.
+func renderMarkdown(source []byte) markdownDocument {
+	text := strings.ReplaceAll(string(source), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\x00", "�")
+	r := &markdownRenderer{links: map[string]markdownLink{}, slugs: map[string]int{}}
+
+	var lines []string
+	inFence := ""
+	for _, line := range strings.Split(text, "\n") {
+		line = expandTabs(line)
+		// Link reference definitions are collected first, so links can refer
+		// to definitions further down.
+		if m := reMarkdownFence.FindStringSubmatch(line); m != nil {
+			if inFence == "" {
+				inFence = m[1]
+			} else if strings.HasPrefix(m[1], inFence) && strings.TrimSpace(line) == m[1] {
+				inFence = ""
+			}
+		} else if m := reMarkdownLinkDef.FindStringSubmatch(line); m != nil && inFence == "" {
+			label := normalizeLinkLabel(m[1])
+			if _, ok := r.links[label]; !ok {
+				r.links[label] = markdownLink{url: unescapeMarkdown(m[2] + m[3]), title: unescapeMarkdown(m[4] + m[5] + m[6])}
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var b strings.Builder
+	r.renderBlocks(&b, lines, false)
+	return markdownDocument{html: b.String(), title: r.title}
+}
+
+// expandTabs replaces the tabs of the indentation of a line with spaces, to
+// the next multiple of four columns.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	column := 0
+	for i, c := range line {
+		switch c {
+		case '\t':
+			n := 4 - column%4
+			b.WriteString(strings.Repeat(" ", n))
+			column += n
+		case ' ':
+			b.WriteByte(' ')
+			column++
+		default:
+			b.WriteString(line[i:])
+			return b.String()
+		}
+	}
+	return b.String()
+}
+
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// startsBlock reports whether a line starts a block that interrupts a
+// paragraph.
+func startsBlock(line string) bool {
+	if reMarkdownFence.MatchString(line) || reMarkdownATX.MatchString(line) || reMarkdownHR.MatchString(line) ||
+		reMarkdownQuote.MatchString(line) || reMarkdownHTML.MatchString(line) {
+		return true
+	}
+	// Only bullets and lists starting at 1 interrupt a paragraph, and not
+	// when empty.
+	if m := reMarkdownListItem.FindStringSubmatch(line); m != nil && !isBlank(line[len(m[0]):]) {
+		return !unicode.IsDigit(rune(m[2][0])) || m[2][:len(m[2])-1] == "1"
+	}
+	return false
+}
+
+// renderBlocks renders a sequence of blocks. In tight lists, paragraphs are
+// not wrapped in <p>.
+func (r *markdownRenderer) renderBlocks(b *strings.Builder, lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case leadingSpaces(line) >= 4:
+			i = r.renderIndentedCode(b, lines, i)
+		case reMarkdownFence.MatchString(line):
+			i = r.renderFence(b, lines, i)
+		case reMarkdownATX.MatchString(line):
+			m := reMarkdownATX.FindStringSubmatch(line)
+			r.renderHeading(b, len(m[1]), m[2])
+			i++
+		case reMarkdownHR.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+		case reMarkdownQuote.MatchString(line):
+			i = r.renderQuote(b, lines, i)
+		case reMarkdownListItem.MatchString(line):
+			i = r.renderList(b, lines, i)
+		case strings.HasPrefix(strings.TrimLeft(line, " "), "<!--"):
+			// A comment ends with its closing line rather than a blank line.
+			for ; i < len(lines); i++ {
+				b.WriteString(lines[i] + "\n")
+				if strings.Contains(lines[i], "-->") {
+					i++
+					break
+				}
+			}
+		case reMarkdownHTML.MatchString(line):
+			for ; i < len(lines) && !isBlank(lines[i]); i++ {
+				b.WriteString(lines[i] + "\n")
+			}
+		case i+1 < len(lines) && strings.Contains(line, "|") && reMarkdownTableSep.MatchString(lines[i+1]) &&
+			len(splitTableRow(line)) == len(splitTableRow(lines[i+1])):
+			i = r.renderTable(b, lines, i)
+		default:
+			i = r.renderParagraph(b, lines, i, tight)
+		}
+	}
+}
+
+func (r *markdownRenderer) renderIndentedCode(b *strings.Builder, lines []string, i int) int {
+	var code []string
+	for ; i < len(lines) && (isBlank(lines[i]) || leadingSpaces(lines[i]) >= 4); i++ {
+		code = append(code, strings.TrimPrefix(lines[i], "    "))
+	}
+	for len(code) > 0 && isBlank(code[len(code)-1]) {
+		code = code[:len(code)-1]
+	}
+	b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "\n</code></pre>\n")
+	return i
+}
+
+func (r *markdownRenderer) renderFence(b *strings.Builder, lines []string, i int) int {
+	m := reMarkdownFence.FindStringSubmatch(lines[i])
+	fence, info := m[1], m[2]
+	indent := leadingSpaces(lines[i])
+	var code []string
+	for i++; i < len(lines); i++ {
+		if trimmed := strings.TrimSpace(lines[i]); strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			i++
+			break
+		}
+		line := lines[i]
+		line = line[min(indent, leadingSpaces(line)):]
+		code = append(code, line)
+	}
+	class := ""
+	if info != "" {
+		class = ` class="language-` + html.EscapeString(info) + `"`
+	}
+	content := html.EscapeString(strings.Join(code, "\n"))
+	if len(code) > 0 {
+		content += "\n"
+	}
+	b.WriteString("<pre><code" + class + ">" + content + "</code></pre>\n")
+	return i
+}
+
+// renderHeading renders a heading with an id derived from its text, like
+// GitHub does, numbered when it repeats.
+func (r *markdownRenderer) renderHeading(b *strings.Builder, level int, text string) {
+	content := r.renderInline(strings.TrimSpace(text))
+	plain := html.UnescapeString(reMarkdownTags.ReplaceAllString(content, ""))
+	if level == 1 && r.title == "" {
+		r.title = plain
+	}
+	slug := headingSlug(plain)
+	if n := r.slugs[slug]; n > 0 {
+		r.slugs[slug] = n + 1
+		slug = slug + "-" + strconv.Itoa(n)
+	} else {
+		r.slugs[slug] = 1
+	}
+	fmt.Fprintf(b, "<h%d id=\"%s\">%s</h%d>\n", level, html.EscapeString(slug), content, level)
+}
+
+// headingSlug returns the id of a heading: its lowercase text with spaces
+// replaced by dashes, without punctuation.
+func headingSlug(text string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-' || c == '_':
+			b.WriteRune(c)
+		case c == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+func (r *markdownRenderer) renderQuote(b *strings.Builder, lines []string, i int) int {
+	var quoted []string
+	for ; i < len(lines) && !isBlank(lines[i]); i++ {
+		line := lines[i]
+		if m := reMarkdownQuote.FindString(line); m != "" {
+			quoted = append(quoted, line[len(m):])
+		} else if len(quoted) > 0 && !startsBlock(line) {
+			// A lazy continuation of the quoted paragraph.
+			quoted = append(quoted, line)
+		} else {
+			break
+		}
+	}
+	b.WriteString("<blockquote>\n")
+	r.renderBlocks(b, quoted, false)
+	b.WriteString("</blockquote>\n")
+	return i
+}
+
+// renderList renders a list of items sharing the type of marker of the
+// first. Items hold the lines indented past their marker, and the list is
+// loose when a blank line separates items or blocks of an item.
+func (r *markdownRenderer) renderList(b *strings.Builder, lines []string, i int) int {
+	first := reMarkdownListItem.FindStringSubmatch(lines[i])
+	ordered := unicode.IsDigit(rune(first[2][0]))
+	markerType := first[2][len(first[2])-1:]
+	sameList := func(m []string) bool {
+		return m != nil && unicode.IsDigit(rune(m[2][0])) == ordered && m[2][len(m[2])-1:] == markerType
+	}
+
+	var items [][]string
+	loose := false
+	for i < len(lines) {
+		m := reMarkdownListItem.FindStringSubmatch(lines[i])
+		if !sameList(m) {
+			break
+		}
+		indent := len(m[1]) + len(m[2]) + len(m[3])
+		if len(m[3]) > 4 || len(m[3]) == 0 {
+			indent = len(m[1]) + len(m[2]) + 1
+		}
+		item := []string{lines[i][min(indent, len(lines[i])):]}
+		i++
+		for i < len(lines) {
+			line := lines[i]
+			if isBlank(line) {
+				next := i + 1
+				for next < len(lines) && isBlank(lines[next]) {
+					next++
+				}
+				if next < len(lines) && leadingSpaces(lines[next]) >= indent {
+					item = append(item, "")
+					i++
+					continue
+				}
+				if next < len(lines) && sameList(reMarkdownListItem.FindStringSubmatch(lines[next])) {
+					loose = true
+				}
+				i = next
+				break
+			}
+			if leadingSpaces(line) >= indent {
+				item = append(item, line[indent:])
+			} else if !startsBlock(line) && !reMarkdownListItem.MatchString(line) && !isBlank(item[len(item)-1]) {
+				// A lazy continuation of the item's paragraph.
+				item = append(item, strings.TrimLeft(line, " "))
+			} else {
+				break
+			}
+			i++
+		}
+		items = append(items, item)
+		if i > 0 && isBlank(lines[i-1]) && (i >= len(lines) || !sameList(reMarkdownListItem.FindStringSubmatch(lines[i]))) {
+			break
+		}
+	}
+	for _, item := range items {
+		for j := 0; j < len(item)-1; j++ {
+			if isBlank(item[j]) && !isBlank(item[j+1]) {
+				loose = true
+			}
+		}
+	}
+
+	if ordered {
+		start, _ := strconv.Atoi(first[2][:len(first[2])-1])
+		if start != 1 {
+			fmt.Fprintf(b, "<ol start=\"%d\">\n", start)
+		} else {
+			b.WriteString("<ol>\n")
+		}
+	} else {
+		b.WriteString("<ul>\n")
+	}
+	for _, item := range items {
+		b.WriteString("<li>")
+		if m := reMarkdownTask.FindStringSubmatch(item[0]); m != nil {
+			checked := ""
+			if m[1] != " " {
+				checked = " checked"
+			}
+			b.WriteString(`<input type="checkbox" disabled` + checked + `> `)
+			item[0] = item[0][len(m[0]):]
+		}
+		var content strings.Builder
+		r.renderBlocks(&content, item, !loose)
+		itemHTML := content.String()
+		if !loose {
+			itemHTML = strings.TrimSuffix(itemHTML, "\n")
+		}
+		if strings.HasPrefix(itemHTML, "<") && loose {
+			b.WriteString("\n")
+		}
+		b.WriteString(itemHTML)
+		b.WriteString("</li>\n")
+	}
+	if ordered {
+		b.WriteString("</ol>\n")
+	} else {
+		b.WriteString("</ul>\n")
+	}
+	return i
+}
+
+func (r *markdownRenderer) renderTable(b *strings.Builder, lines []string, i int) int {
+	header := splitTableRow(lines[i])
+	var aligns []string
+	for _, cell := range splitTableRow(lines[i+1]) {
+		left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":")
+		switch {
+		case left && right:
+			aligns = append(aligns, ` style="text-align: center"`)
+		case right:
+			aligns = append(aligns, ` style="text-align: right"`)
+		case left:
+			aligns = append(aligns, ` style="text-align: left"`)
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+	writeRow := func(cells []string, tag string) {
+		b.WriteString("<tr>")
+		for j, align := range aligns {
+			cell := ""
+			if j < len(cells) {
+				cell = cells[j]
+			}
+			fmt.Fprintf(b, "<%s%s>%s</%s>", tag, align, r.renderInline(cell), tag)
+		}
+		b.WriteString("</tr>\n")
+	}
+
+	b.WriteString("<table>\n<thead>\n")
+	writeRow(header, "th")
+	b.WriteString("</thead>\n")
+	i += 2
+	if i < len(lines) && !isBlank(lines[i]) && strings.Contains(lines[i], "|") {
+		b.WriteString("<tbody>\n")
+		for ; i < len(lines) && !isBlank(lines[i]) && !startsBlock(lines[i]); i++ {
+			writeRow(splitTableRow(lines[i]), "td")
+		}
+		b.WriteString("</tbody>\n")
+	}
+	b.WriteString("</table>\n")
+	return i
+}
+
+// splitTableRow splits a table row into its trimmed cells. Escaped pipes
+// are kept in the cells.
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func (r *markdownRenderer) renderParagraph(b *strings.Builder, lines []string, i int, tight bool) int {
+	var text []string
+	for ; i < len(lines) && !isBlank(lines[i]); i++ {
+		if len(text) > 0 {
+			if reMarkdownSetext1.MatchString(lines[i]) || reMarkdownSetext2.MatchString(lines[i]) {
+				level := 1
+				if reMarkdownSetext2.MatchString(lines[i]) {
+					level = 2
+				}
+				r.renderHeading(b, level, strings.Join(text, "\n"))
+				return i + 1
+			}
+			if startsBlock(lines[i]) {
+				break
+			}
+		}
+		text = append(text, strings.TrimLeft(lines[i], " "))
+	}
+	content := r.renderInline(strings.TrimRight(strings.Join(text, "\n"), " "))
+	if tight {
+		b.WriteString(content + "\n")
+	} else {
+		b.WriteString("<p>" + content + "</p>\n")
+	}
+	return i
+}
+
+// renderInline renders the inline content of a block. Code spans, links,
+// images, autolinks and raw HTML are rendered first and replaced by
+// placeholders, so emphasis is only applied to the remaining text.
+func (r *markdownRenderer) renderInline(text string) string {
+	var placeholders []string
+	hold := func(s string) string {
+		placeholders = append(placeholders, s)
+		return "\x00" + strconv.Itoa(len(placeholders)-1) + "\x00"
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && text[i+1] == '\n':
+			out.WriteString(hold("<br>\n"))
+			i += 2
+			continue
+		case c == '\\' && i+1 < len(text) && unicode.IsPunct(rune(text[i+1])) || c == '\\' && i+1 < len(text) && unicode.IsSymbol(rune(text[i+1])):
+			out.WriteString(hold(html.EscapeString(text[i+1 : i+2])))
+			i += 2
+			continue
+		case c == '`':
+			run := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+			fence := text[i : i+run]
+			if end := findCodeSpanEnd(text, i+run, fence); end >= 0 {
+				code := strings.ReplaceAll(text[i+run:end], "\n", " ")
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+					code = code[1 : len(code)-1]
+				}
+				out.WriteString(hold("<code>" + html.EscapeString(code) + "</code>"))
+				i = end + run
+			} else {
+				out.WriteString(fence)
+				i += run
+			}
+			continue
+		case c == '!' && strings.HasPrefix(text[i:], "!["):
+			if rendered, n, ok := r.renderLink(text[i+1:], true); ok {
+				out.WriteString(hold(rendered))
+				i += 1 + n
+				continue
+			}
+		case c == '[':
+			if rendered, n, ok := r.renderLink(text[i:], false); ok {
+				out.WriteString(hold(rendered))
+				i += n
+				continue
+			}
+		case c == '<':
+			if m := reMarkdownAutolink.FindStringSubmatch(text[i:]); m != nil {
+				href := m[1]
+				if !strings.Contains(href, ":") {
+					href = "mailto:" + href
+				}
+				out.WriteString(hold(`<a href="` + html.EscapeString(href) + `">` + html.EscapeString(m[1]) + `</a>`))
+				i += len(m[0])
+				continue
+			}
+			if m := reMarkdownInlineTag.FindString(text[i:]); m != "" {
+				out.WriteString(hold(m))
+				i += len(m)
+				continue
+			}
+		}
+		out.WriteByte(c)
+		i++
+	}
+
+	s := html.EscapeString(out.String())
+	// Entity and character references are kept as written.
+	s = reMarkdownEntity.ReplaceAllStringFunc(s, func(entity string) string {
+		// A known reference is unescaped up to its semicolon.
+		if ref := "&" + entity[len("&amp;"):]; !strings.HasSuffix(html.UnescapeString(ref), ";") {
+			return ref
+		}
+		return entity
+	})
+	s = reMarkdownURL.ReplaceAllStringFunc(s, func(u string) string {
+		return hold(`<a href="` + u + `">` + u + `</a>`)
+	})
+	s = reMarkdownHardBreak.ReplaceAllString(s, "<br>\n")
+	s = reMarkdownStrong.ReplaceAllString(s, "<strong>$1$2</strong>")
+	s = reMarkdownEm.ReplaceAllString(s, "<em>$1$2</em>")
+	s = reMarkdownStrike.ReplaceAllString(s, "<del>$1</del>")
+	// Placeholders can hold other placeholders, such as links with code.
+	for strings.Contains(s, "\x00") {
+		s = restorePlaceholders(s, placeholders)
+	}
+	return s
+}
+
+func restorePlaceholders(s string, placeholders []string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(s, 0)
+		if start < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := strings.IndexByte(s[start+1:], 0)
+		if end < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		n, _ := strconv.Atoi(s[start+1 : start+1+end])
+		b.WriteString(s[:start])
+		if n < len(placeholders) {
+			b.WriteString(placeholders[n])
+		}
+		s = s[start+end+2:]
+	}
+}
+
+// findCodeSpanEnd returns the start of the backtick run closing a code span,
+// of exactly the length of fence, or -1.
+func findCodeSpanEnd(text string, from int, fence string) int {
+	for i := from; i < len(text); {
+		j := strings.Index(text[i:], fence)
+		if j < 0 {
+			return -1
+		}
+		start := i + j
+		end := start + len(fence)
+		if (start == 0 || text[start-1] != '`') && (end >= len(text) || text[end] != '`') {
+			return start
+		}
+		for end < len(text) && text[end] == '`' {
+			end++
+		}
+		i = end
+	}
+	return -1
+}
+
+// renderLink renders a link or, with image, an image, starting at the [ of
+// text. It returns the HTML and the length of the source consumed. Inline
+// links, full, collapsed and shortcut reference links are supported.
+func (r *markdownRenderer) renderLink(text string, image bool) (string, int, bool) {
+	end := matchingBracket(text)
+	if end < 0 {
+		return "", 0, false
+	}
+	label := text[1:end]
+	rest := text[end+1:]
+	var dest, title string
+	n := end + 1
+
+	if strings.HasPrefix(rest, "(") {
+		d, t, consumed, ok := parseLinkDestination(rest)
+		if !ok {
+			return "", 0, false
+		}
+		dest, title, n = d, t, n+consumed
+	} else {
+		ref := label
+		if strings.HasPrefix(rest, "[") {
+			if strings.HasPrefix(rest, "[]") {
+				n += 2
+			} else if refEnd := strings.IndexByte(rest, ']'); refEnd > 0 {
+				ref = rest[1:refEnd]
+				n += refEnd + 1
+			}
+		}
+		link, ok := r.links[normalizeLinkLabel(ref)]
+		if !ok {
+			return "", 0, false
+		}
+		dest, title = link.url, link.title
+	}
+
+	titleAttr := ""
+	if title != "" {
+		titleAttr = ` title="` + html.EscapeString(title) + `"`
+	}
+	if image {
+		alt := html.UnescapeString(reMarkdownTags.ReplaceAllString(r.renderInline(label), ""))
+		return `<img src="` + html.EscapeString(dest) + `" alt="` + html.EscapeString(alt) + `"` + titleAttr + `>`, n, true
+	}
+	return `<a href="` + html.EscapeString(dest) + `"` + titleAttr + `>` + r.renderInline(label) + `</a>`, n, true
+}
+
+// matchingBracket returns the index of the ] closing the [ at the start of
+// text, skipping nested brackets, escapes and code spans, or -1.
+func matchingBracket(text string) int {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '`':
+			run := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+			if end := findCodeSpanEnd(text, i+run, text[i:i+run]); end >= 0 {
+				i = end + run - 1
+			} else {
+				i += run - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseLinkDestination parses the (destination "title") of an inline link.
+func parseLinkDestination(text string) (dest string, title string, n int, ok bool) {
+	i := 1
+	skipSpace := func() {
+		for i < len(text) && (text[i] == ' ' || text[i] == '\n') {
+			i++
+		}
+	}
+	skipSpace()
+	if i < len(text) && text[i] == '<' {
+		end := strings.IndexByte(text[i:], '>')
+		if end < 0 {
+			return "", "", 0, false
+		}
+		dest = text[i+1 : i+end]
+		i += end + 1
+	} else {
+		start, depth := i, 0
+		for ; i < len(text) && text[i] != ' ' && text[i] != '\n'; i++ {
+			if text[i] == '(' {
+				depth++
+			} else if text[i] == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			}
+		}
+		dest = text[start:i]
+	}
+	skipSpace()
+	if i < len(text) && (text[i] == '"' || text[i] == '\'' || text[i] == '(') {
+		closing := text[i]
+		if closing == '(' {
+			closing = ')'
+		}
+		end := strings.IndexByte(text[i+1:], closing)
+		if end < 0 {
+			return "", "", 0, false
+		}
+		title = text[i+1 : i+1+end]
+		i += end + 2
+		skipSpace()
+	}
+	if i >= len(text) || text[i] != ')' {
+		return "", "", 0, false
+	}
+	return unescapeMarkdown(dest), unescapeMarkdown(title), i + 1, true
+}
+
+// unescapeMarkdown removes the backslashes escaping punctuation.
+func unescapeMarkdown(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (unicode.IsPunct(rune(s[i+1])) || unicode.IsSymbol(rune(s[i+1]))) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// normalizeLinkLabel matches link labels case-insensitively and ignoring
+// repeated white space.
+func normalizeLinkLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		markdown string
+		expected string
+	}{
+		{"# Hello *world*", "<h1 id=\"hello-world\">Hello <em>world</em></h1>\n"},
+		{"Title\n=====\n\nSub\n---", "<h1 id=\"title\">Title</h1>\n<h2 id=\"sub\">Sub</h2>\n"},
+		{"## Usage\n## Usage", "<h2 id=\"usage\">Usage</h2>\n<h2 id=\"usage-1\">Usage</h2>\n"},
+		{"one\ntwo  \nthree", "<p>one\ntwo<br>\nthree</p>\n"},
+		{"**bold** and __strong__, *em* and _em_, ~~gone~~, snake_case_name",
+			"<p><strong>bold</strong> and <strong>strong</strong>, <em>em</em> and <em>em</em>, <del>gone</del>, snake_case_name</p>\n"},
+		{"Use `a < b` and ``x ` y``", "<p>Use <code>a &lt; b</code> and <code>x ` y</code></p>\n"},
+		{"```go\nfmt.Println(\"<hi>\")\n```", "<pre><code class=\"language-go\">fmt.Println(&#34;&lt;hi&gt;&#34;)\n</code></pre>\n"},
+		{"    indented\n    code", "<pre><code>indented\ncode\n</code></pre>\n"},
+		{"> quoted\nlazy", "<blockquote>\n<p>quoted\nlazy</p>\n</blockquote>\n"},
+		{"- a\n- b\n  - nested\n- [x] done", "<ul>\n<li>a</li>\n<li>b\n<ul>\n<li>nested</li>\n</ul></li>\n<li><input type=\"checkbox\" disabled checked> done</li>\n</ul>\n"},
+		{"3. three\n4. four", "<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n"},
+		{"- a\n\n- b", "<ul>\n<li>\n<p>a</p>\n</li>\n<li>\n<p>b</p>\n</li>\n</ul>\n"},
+		{"| A | B |\n|:--|--:|\n| 1 | `x\\|y` |", "<table>\n<thead>\n<tr><th style=\"text-align: left\">A</th><th style=\"text-align: right\">B</th></tr>\n</thead>\n<tbody>\n<tr><td style=\"text-align: left\">1</td><td style=\"text-align: right\"><code>x|y</code></td></tr>\n</tbody>\n</table>\n"},
+		{"[docs](docs/intro.md \"Intro\") ![logo](img/logo.png)", "<p><a href=\"docs/intro.md\" title=\"Intro\">docs</a> <img src=\"img/logo.png\" alt=\"logo\"></p>\n"},
+		{"See [the guide][guide] and [guide].\n\n[guide]: https://example.com/guide", "<p>See <a href=\"https://example.com/guide\">the guide</a> and <a href=\"https://example.com/guide\">guide</a>.</p>\n"},
+		{"<https://example.com> and https://example.com/a.", "<p><a href=\"https://example.com\">https://example.com</a> and <a href=\"https://example.com/a\">https://example.com/a</a>.</p>\n"},
+		{"<div class=\"note\">\n*raw*\n</div>", "<div class=\"note\">\n*raw*\n</div>\n"},
+		{"<!--toc-->\n- [Usage](#usage)", "<!--toc-->\n<ul>\n<li><a href=\"#usage\">Usage</a></li>\n</ul>\n"},
+		{"a <kbd>Ctrl</kbd> \\*not em\\*", "<p>a <kbd>Ctrl</kbd> *not em*</p>\n"},
+		{"***", "<hr>\n"},
+		// Lists
+		{"* a\n* b\n\n1. one\n2. two", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n<ol>\n<li>one</li>\n<li>two</li>\n</ol>\n"},
+		{"1) first\n2) second", "<ol>\n<li>first</li>\n<li>second</li>\n</ol>\n"},
+		{"- a\n\n  continued\n- b", "<ul>\n<li>\n<p>a</p>\n<p>continued</p>\n</li>\n<li>\n<p>b</p>\n</li>\n</ul>\n"},
+		{"- [ ] todo\n- [X] done", "<ul>\n<li><input type=\"checkbox\" disabled> todo</li>\n<li><input type=\"checkbox\" disabled checked> done</li>\n</ul>\n"},
+		{"- a\n  ```\n  code\n  ```\n- b", "<ul>\n<li>a\n<pre><code>code\n</code></pre></li>\n<li>b</li>\n</ul>\n"},
+		// Tables
+		{"A | B\n--- | ---\n1 | 2\n3", "<table>\n<thead>\n<tr><th>A</th><th>B</th></tr>\n</thead>\n<tbody>\n<tr><td>1</td><td>2</td></tr>\n<tr><td>3</td><td></td></tr>\n</tbody>\n</table>\n"},
+		{"| A |\n|:-:|\n| *em* |", "<table>\n<thead>\n<tr><th style=\"text-align: center\">A</th></tr>\n</thead>\n<tbody>\n<tr><td style=\"text-align: center\"><em>em</em></td></tr>\n</tbody>\n</table>\n"},
+		{"| not | a table |\nno delimiter", "<p>| not | a table |\nno delimiter</p>\n"},
+		// Fences
+		{"~~~\n~~~ inside\n~~~", "<pre><code>~~~ inside\n</code></pre>\n"},
+		{"````md\n```\nnested\n```\n````", "<pre><code class=\"language-md\">```\nnested\n```\n</code></pre>\n"},
+		{"```\n<b>&amp;</b>\n\n\n```", "<pre><code>&lt;b&gt;&amp;amp;&lt;/b&gt;\n\n\n</code></pre>\n"},
+		{"```\nunterminated", "<pre><code>unterminated\n</code></pre>\n"},
+		// Reference links
+		{"[Ref][] and [ref][Ref] and [missing][nope]\n\n[ref]: /docs \"Docs\"", "<p><a href=\"/docs\" title=\"Docs\">Ref</a> and <a href=\"/docs\" title=\"Docs\">ref</a> and [missing][nope]</p>\n"},
+		{"[x][a]\n\n[a]: <docs/my page.html> 'Title'", "<p><a href=\"docs/my page.html\" title=\"Title\">x</a></p>\n"},
+		{"![alt][img] [a]\n\n[img]: logo.png\n[a]: /x\\_y", "<p><img src=\"logo.png\" alt=\"alt\"> <a href=\"/x_y\">a</a></p>\n"},
+		{"*see [x](y)* and **`a`**", "<p><em>see <a href=\"y\">x</a></em> and <strong><code>a</code></strong></p>\n"},
+		// Escapes and entities
+		{"\\# not a heading \\[not a link\\](x) \\`code\\`", "<p># not a heading [not a link](x) `code`</p>\n"},
+		{"a \\\\ b \\_c\\_ `\\*` *a\\*b*", "<p>a \\ b _c_ <code>\\*</code> <em>a*b</em></p>\n"},
+		{"AT&T &copy; &#169; &amp; &lt; &notanentity; \"q\"", "<p>AT&amp;T &copy; &#169; &amp; &lt; &amp;notanentity; &#34;q&#34;</p>\n"},
+		{"[a *b*](x?a=1&b=2)", "<p><a href=\"x?a=1&amp;b=2\">a <em>b</em></a></p>\n"},
+	}
+	for _, test := range tests {
+		if doc := renderMarkdown([]byte(test.markdown)); doc.html != test.expected {
+			t.Fatalf("Expected %q to render as\n%q, got\n%q", test.markdown, test.expected, doc.html)
+		}
+	}
+
+	if title := renderMarkdown([]byte("Intro\n\n# First\n# Second")).title; title != "First" {
+		t.Fatalf("Expected the first heading as title, got %q", title)
+	}
+}
+
+func TestServeMarkdown(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"README.md":      "# Project\n\n![logo](img/logo.png)\n\nSee [the docs](docs/guide.md).",
+		"img/logo.png":   "png",
+		"docs/guide.md":  "# Guide\n\n<link rel=\"stylesheet\" href=\"guide.css\">",
+		"docs/guide.css": "",
+	})
+	entry := filepath.Join(dir, "README.md")
+
+	ts := httptest.NewServer(DevServer(entry, Config{}))
+	defer ts.Close()
+	get := func(path string) string {
+		resp, err := ts.Client().Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+			t.Fatalf("Expected %s to be served as HTML, got %s", path, resp.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	body := get("/")
+	for _, expected := range []string{"<title>Project</title>", `<h1 id="project">Project</h1>`, `<img src="img/logo.png" alt="logo">`, "new WebSocket"} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("Expected the rendered page to contain %s, got %s", expected, body)
+		}
+	}
+	if body := get("/docs/guide.md"); !strings.Contains(body, `<h1 id="guide">Guide</h1>`) {
+		t.Fatalf("Expected other Markdown files to be rendered, got %s", body)
+	}
+
+	writeFiles(t, dir, map[string]string{markdownLayoutFile: "<main>{{dotdev::content}}</main>"})
+	if body := get("/"); !strings.HasPrefix(body, "<main><h1") {
+		t.Fatalf("Expected the custom layout to be used, got %s", body)
+	}
+
+	files := strings.Join(buildDependencyGraph(entry, Config{}).Files(), "\n")
+	for _, expected := range []string{"README.md", "logo.png", markdownLayoutFile} {
+		if !strings.Contains(files, expected) {
+			t.Fatalf("Expected %s to be watched, got %s", expected, files)
+		}
+	}
+	files = strings.Join(buildPageDependencyGraph(dir, filepath.Join(dir, "docs", "guide.md"), Config{}).Files(), "\n")
+	if !strings.Contains(files, filepath.Join("docs", "guide.css")) {
+		t.Fatalf("Expected the dependencies of served pages to be resolved from their directory, got %s", files)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency histogram.
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// maxMetricSeries limits the number of path and status combinations tracked,
+// so scanning for missing files cannot grow the metrics without bound.
+const maxMetricSeries = 1000
+
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+type seriesKey struct {
+	path   string
+	status int
+}
+
+// requestMetrics collects request latency histograms per path and status.
+type requestMetrics struct {
+	mu     sync.Mutex
+	series map[seriesKey]*histogram
+}
+
+var httpMetrics = &requestMetrics{series: map[seriesKey]*histogram{}}
+
+// Observe records the duration of a request.
+func (m *requestMetrics) Observe(path string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := seriesKey{path: path, status: status}
+	h, ok := m.series[key]
+	if !ok {
+		if len(m.series) >= maxMetricSeries {
+			key.path = "other"
+			h, ok = m.series[key]
+		}
+		if !ok {
+			h = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+			m.series[key] = h
+		}
+	}
+	seconds := duration.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// WritePrometheus writes the histograms in the Prometheus text exposition format.
+func (m *requestMetrics) WritePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]seriesKey, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	const name = "dotdev_http_request_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Duration of HTTP requests by path and status.\n", name)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, key := range keys {
+		h := m.series[key]
+		labels := fmt.Sprintf(`path="%s",status="%d"`, escapeLabel(key.path), key.status)
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(bound, 'g', -1, 64), h.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+	}
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// metricsHandler measures the latency of every request passed to next. WebSocket
+// connections are long-lived and not measured.
+func metricsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+		if rec.hijacked {
+			return
+		}
+		httpMetrics.Observe(r.URL.Path, rec.Status(), time.Since(start))
+	})
+}
+
+// serverStatus is the JSON document served at /__dotdev/status.
+type serverStatus struct {
+	Version          string    `json:"version"`
+	ServePath        string    `json:"servePath"`
+	ServeDir         string    `json:"serveDir"`
+	Urls             []string  `json:"urls"`
+	StartedAt        time.Time `json:"startedAt"`
+	UptimeSeconds    float64   `json:"uptimeSeconds"`
+	Requests         int       `json:"requests"`
+	Updates          int       `json:"updates"`
+	Errors           int       `json:"errors"`
+	ConnectedClients int       `json:"connectedClients"`
+	WatchedFiles     int       `json:"watchedFiles"`
+	Paused           bool      `json:"paused"`
+}
+
+func newServerStatus(state State) serverStatus {
+	return serverStatus{
+		Version:          Version,
+		ServePath:        state.ServePath,
+		ServeDir:         state.ServeFsDir,
+		Urls:             state.Urls,
+		StartedAt:        state.StartedAt,
+		UptimeSeconds:    time.Since(state.StartedAt).Seconds(),
+		Requests:         state.TotalRequests,
+		Updates:          state.TotalUpdates,
+		Errors:           state.TotalErrors,
+		ConnectedClients: state.ConnectedClients,
+		WatchedFiles:     watchedFiles.Count(),
+		Paused:           state.Paused,
+	}
+}
+
+// statusHandler serves the server state as JSON.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(newServerStatus(ServerState.Snapshot()))
+}
+
+// metricsPromHandler serves the server state and request latencies in the
+// Prometheus text format.
+func metricsPromHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	state := ServerState.Snapshot()
+	writeMetric(w, "dotdev_requests_total", "counter", "HTTP requests served, not counting dotdev endpoints.", float64(state.TotalRequests))
+	writeMetric(w, "dotdev_errors_total", "counter", "Error pages served.", float64(state.TotalErrors))
+	writeMetric(w, "dotdev_reload_broadcasts_total", "counter", "Reloads broadcast to connected clients.", float64(state.TotalUpdates))
+	writeMetric(w, "dotdev_websocket_clients", "gauge", "Connected WebSocket clients.", float64(state.ConnectedClients))
+	writeMetric(w, "dotdev_watched_files", "gauge", "Files watched for changes.", float64(watchedFiles.Count()))
+	changes := 0
+	for _, f := range watchedFiles.List() {
+		changes += f.Changes
+	}
+	writeMetric(w, "dotdev_file_changes_total", "counter", "Changes detected in watched files.", float64(changes))
+	writeMetric(w, "dotdev_uptime_seconds", "gauge", "Time since the server started.", time.Since(state.StartedAt).Seconds())
+	httpMetrics.WritePrometheus(w)
+}
+
+func writeMetric(w io.Writer, name string, kind string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+	fmt.Fprintf(w, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStatusAndMetricsEndpoints verifies the JSON status and the Prometheus metrics.
+func TestStatusAndMetricsEndpoints(t *testing.T) {
+	tmpDir := t.TempDir()
+	htmlPath := filepath.Join(tmpDir, "index.html")
+	os.WriteFile(htmlPath, []byte(`<html><body>Hello</body></html>`), 0644)
+
+	ts := httptest.NewServer(DevServer(htmlPath, Config{}))
+	defer ts.Close()
+
+	for _, path := range []string{"/", "/missing.css"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(ts.URL + "/__dotdev/status")
+	if err != nil {
+		t.Fatalf("GET status failed: %v", err)
+	}
+	var status serverStatus
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if status.Version != Version || status.Requests < 1 {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+	requests := status.Requests
+	ServerState.ResetCounters()
+	resp, err = http.Get(ts.URL + "/__dotdev/status")
+	if err != nil {
+		t.Fatalf("GET status failed: %v", err)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if err != nil || status.Requests < requests {
+		t.Fatalf("Expected the request total to keep counting after clearing the counters, got %d after %d", status.Requests, requests)
+	}
+
+	resp, err = http.Get(ts.URL + "/__dotdev/metrics")
+	if err != nil {
+		t.Fatalf("GET metrics failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	metrics := string(body)
+	for _, want := range []string{
+		"# TYPE dotdev_http_request_duration_seconds histogram",
+		`dotdev_http_request_duration_seconds_count{path="/",status="200"}`,
+		`dotdev_http_request_duration_seconds_bucket{path="/missing.css",status="404",le="+Inf"} 1`,
+		"dotdev_reload_broadcasts_total ",
+		"dotdev_watched_files ",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Fatalf("Expected metrics to contain %q, got:\n%s", want, metrics)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// nodeModulesPrefix is the URL prefix of a node_modules directory found above
+// the serve directory, which is not reachable under the root otherwise.
+const nodeModulesPrefix = internalPathPrefix + "node_modules"
+
+// moduleConditions are the conditions of package.json exports matched when
+// resolving for the browser. Like in Node, the first of them in the order of
+// the conditions object wins.
+var moduleConditions = map[string]bool{"browser": true, "import": true, "module": true, "default": true}
+
+var (
+	reImportMapElement = regexp.MustCompile(`(?is)(<script\b[^>]*\btype=["']?importmap["']?[^>]*>)(.*?)(</script\s*>)`)
+	reHeadStart        = regexp.MustCompile(`(?i)<head\b[^>]*>`)
+	reFirstScript      = regexp.MustCompile(`(?i)<script\b`)
+)
+
+// importMaps caches the modules resolved for the import map of each page, so
+// requests do not rebuild the dependency graph. The file watcher replaces
+// them whenever it rescans the pages after a change.
+var importMaps = struct {
+	sync.Mutex
+	pages map[string]map[string]string
+}{pages: map[string]map[string]string{}}
+
+// pageImportMap returns the modules resolved for the import map of a page,
+// building its dependency graph when they are not cached yet.
+func pageImportMap(root string, page string, config Config) map[string]string {
+	importMaps.Lock()
+	imports, ok := importMaps.pages[page]
+	importMaps.Unlock()
+	if ok {
+		return imports
+	}
+	imports = buildPageDependencyGraph(root, page, config).moduleImports
+	importMaps.Lock()
+	defer importMaps.Unlock()
+	// A rescan of the watcher may have cached a newer result meanwhile.
+	if cached, ok := importMaps.pages[page]; ok {
+		return cached
+	}
+	importMaps.pages[page] = imports
+	return imports
+}
+
+// updateImportMap replaces the cached import map of a page after a rescan.
+func updateImportMap(page string, imports map[string]string) {
+	importMaps.Lock()
+	defer importMaps.Unlock()
+	importMaps.pages[page] = imports
+}
+
+// withNodeModules adds a mount for the closest node_modules directory above
+// the serve directory, so the packages it resolves to can be served.
+func withNodeModules(config Config, root string) Config {
+	if !config.ResolveModules {
+		return config
+	}
+	dir, err := filepath.Abs(root)
+	if err != nil {
+		return config
+	}
+	if isDir(filepath.Join(dir, "node_modules")) {
+		return config
+	}
+	for parent := filepath.Dir(dir); parent != dir; dir, parent = parent, filepath.Dir(parent) {
+		if nodeModules := filepath.Join(parent, "node_modules"); isDir(nodeModules) {
+			config.Mounts = append(append([]Mount(nil), config.Mounts...), Mount{Prefix: nodeModulesPrefix, Dir: nodeModules})
+			return config
+		}
+	}
+	return config
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// resolveBareSpecifier resolves a bare module specifier such as "lit" or
+// "@scope/pkg/sub.js" to a file, like Node.js does: from the node_modules
+// directories of dir and its parents, using the exports, module or main
+// field of the package.json of the package.
+func resolveBareSpecifier(dir string, specifier string) (string, bool) {
+	name, subpath := splitSpecifier(specifier)
+	if name == "" {
+		return "", false
+	}
+	for {
+		pkgDir := filepath.Join(dir, "node_modules", filepath.FromSlash(name))
+		if isDir(pkgDir) {
+			return resolvePackageFile(pkgDir, subpath)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// splitSpecifier splits a bare specifier into the package name and the
+// subpath, "." for the package itself.
+func splitSpecifier(specifier string) (name string, subpath string) {
+	parts := strings.SplitN(specifier, "/", 3)
+	n := 1
+	if strings.HasPrefix(specifier, "@") {
+		if len(parts) < 2 {
+			return "", ""
+		}
+		n = 2
+	}
+	name = strings.Join(parts[:min(n, len(parts))], "/")
+	if rest := strings.TrimPrefix(specifier, name); rest != "" {
+		return name, "." + rest
+	}
+	return name, "."
+}
+
+// packageJSON holds the fields of a package.json used to resolve modules.
+type packageJSON struct {
+	Exports json.RawMessage `json:"exports"`
+	Module  string          `json:"module"`
+	Browser json.RawMessage `json:"browser"`
+	Main    string          `json:"main"`
+}
+
+// resolvePackageFile resolves a subpath of the package in pkgDir. Exports take
+// precedence and limit the subpaths that can be imported.
+func resolvePackageFile(pkgDir string, subpath string) (string, bool) {
+	var pkg packageJSON
+	if data, err := os.ReadFile(filepath.Join(pkgDir, "package.json")); err == nil {
+		json.Unmarshal(data, &pkg)
+	}
+	if len(pkg.Exports) > 0 && string(pkg.Exports) != "null" {
+		target, ok := resolveExports(pkg.Exports, subpath)
+		if !ok {
+			return "", false
+		}
+		return packageFile(pkgDir, target)
+	}
+	if subpath != "." {
+		return packageFile(pkgDir, subpath)
+	}
+	var browser string
+	json.Unmarshal(pkg.Browser, &browser)
+	for _, entry := range []string{pkg.Module, browser, pkg.Main, "index.js"} {
+		if entry == "" {
+			continue
+		}
+		if file, ok := packageFile(pkgDir, entry); ok {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// packageFile returns the file of a path in a package, trying the .js
+// extension and an index.js for paths without one.
+func packageFile(pkgDir string, target string) (string, bool) {
+	file := filepath.Join(pkgDir, filepath.FromSlash(path.Clean("/"+target)))
+	for _, candidate := range []string{file, file + ".js", filepath.Join(file, "index.js")} {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// resolveExports resolves a subpath with the exports field of a package.json,
+// which maps subpaths, possibly with a * pattern, to targets or conditions.
+func resolveExports(exports json.RawMessage, subpath string) (string, bool) {
+	keys, subpaths, ok := decodeObject(exports)
+	dotted := 0
+	for _, key := range keys {
+		if strings.HasPrefix(key, ".") {
+			dotted++
+		}
+	}
+	if dotted > 0 && dotted < len(keys) {
+		// Subpaths and conditions cannot be mixed.
+		return "", false
+	}
+	if !ok || dotted == 0 {
+		// The exports only hold the conditions of the package itself.
+		if subpath != "." {
+			return "", false
+		}
+		return resolveExportTarget(exports, "")
+	}
+	if target, ok := subpaths[subpath]; ok {
+		return resolveExportTarget(target, "")
+	}
+	// The longest pattern matching the subpath wins.
+	sort.SliceStable(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	for _, key := range keys {
+		prefix, suffix, ok := strings.Cut(key, "*")
+		if ok && strings.HasPrefix(subpath, prefix) && strings.HasSuffix(subpath, suffix) && len(subpath) >= len(prefix)+len(suffix) {
+			return resolveExportTarget(subpaths[key], subpath[len(prefix):len(subpath)-len(suffix)])
+		}
+	}
+	return "", false
+}
+
+// resolveExportTarget resolves a target of the exports field: a path, in
+// which * is replaced by the matched pattern, an array of fallbacks, or an
+// object of conditions.
+func resolveExportTarget(target json.RawMessage, match string) (string, bool) {
+	var s string
+	if json.Unmarshal(target, &s) == nil {
+		return strings.ReplaceAll(s, "*", match), s != ""
+	}
+	var fallbacks []json.RawMessage
+	if json.Unmarshal(target, &fallbacks) == nil {
+		for _, fallback := range fallbacks {
+			if resolved, ok := resolveExportTarget(fallback, match); ok {
+				return resolved, true
+			}
+		}
+		return "", false
+	}
+	if conditions, values, ok := decodeObject(target); ok {
+		for _, condition := range conditions {
+			if !moduleConditions[condition] {
+				continue
+			}
+			if resolved, ok := resolveExportTarget(values[condition], match); ok {
+				return resolved, true
+			}
+		}
+	}
+	return "", false
+}
+
+// decodeObject decodes a JSON object, returning its keys in the order of the
+// document, which json.Unmarshal into a map loses.
+func decodeObject(data json.RawMessage) ([]string, map[string]json.RawMessage, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, nil, false
+	}
+	var keys []string
+	values := map[string]json.RawMessage{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, nil, false
+		}
+		key, _ := t.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, false
+		}
+		if _, seen := values[key]; !seen {
+			keys = append(keys, key)
+		}
+		values[key] = value
+	}
+	return keys, values, true
+}
+
+// injectImportMap adds the imports to the import map of a document, or
+// inserts an import map before its first script. Imports of an existing
+// import map take precedence.
+func injectImportMap(content []byte, imports map[string]string) []byte {
+	if len(imports) == 0 {
+		return content
+	}
+	switch detectCharset(content) {
+	case "utf-16le", "utf-16be":
+		return content
+	}
+	if loc := reImportMapElement.FindSubmatchIndex(content); loc != nil {
+		var importMap map[string]json.RawMessage
+		if err := json.Unmarshal(content[loc[4]:loc[5]], &importMap); err != nil {
+			return content
+		}
+		existing := map[string]string{}
+		json.Unmarshal(importMap["imports"], &existing)
+		for specifier, target := range imports {
+			if _, ok := existing[specifier]; !ok {
+				existing[specifier] = target
+			}
+		}
+		importMap["imports"], _ = json.Marshal(existing)
+		data, _ := json.Marshal(importMap)
+		return concatBytes(content[:loc[4]], data, content[loc[5]:])
+	}
+
+	data, _ := json.Marshal(map[string]map[string]string{"imports": imports})
+	element := []byte("<script type=\"importmap\">" + string(data) + "</script>")
+	if loc := reHeadStart.FindIndex(content); loc != nil {
+		return concatBytes(content[:loc[1]], element, content[loc[1]:])
+	}
+	if loc := reFirstScript.FindIndex(content); loc != nil {
+		return concatBytes(content[:loc[0]], element, content[loc[0]:])
+	}
+	return concatBytes(element, content)
+}
+
+func concatBytes(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
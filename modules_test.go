@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestResolveBareSpecifier(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"node_modules/lit/package.json":         `{"exports": {".": {"types": "./index.d.ts", "browser": {"development": "./dev.js", "default": "./index.js"}}, "./directives/*": "./directives/*.js"}}`,
+		"node_modules/lit/index.js":             "",
+		"node_modules/lit/directives/repeat.js": "",
+		"node_modules/legacy/package.json":      `{"main": "lib/main.js", "module": "esm/index.mjs"}`,
+		"node_modules/legacy/esm/index.mjs":     "",
+		"node_modules/legacy/lib/util.js":       "",
+		"node_modules/@scope/pkg/package.json":  `{"exports": "./dist/pkg.js"}`,
+		"node_modules/@scope/pkg/dist/pkg.js":   "",
+		"node_modules/plain/index.js":           "",
+		"node_modules/ordered/package.json":     `{"exports": {"import": "./esm.js", "browser": "./browser.js"}}`,
+		"node_modules/ordered/esm.js":           "",
+		"node_modules/ordered/browser.js":       "",
+		"node_modules/mixed/package.json":       `{"exports": {"import": "./esm.js", ".": "./index.js"}}`,
+		"node_modules/mixed/esm.js":             "",
+		"node_modules/mixed/index.js":           "",
+		"src/app/node_modules/nested/index.js":  "",
+	})
+
+	tests := map[string]string{
+		"lit":                   "node_modules/lit/index.js",
+		"lit/directives/repeat": "node_modules/lit/directives/repeat.js",
+		"lit/index.js":          "",
+		"legacy":                "node_modules/legacy/esm/index.mjs",
+		"legacy/lib/util":       "node_modules/legacy/lib/util.js",
+		"@scope/pkg":            "node_modules/@scope/pkg/dist/pkg.js",
+		"plain":                 "node_modules/plain/index.js",
+		"ordered":               "node_modules/ordered/esm.js",
+		"mixed":                 "",
+		"nested":                "src/app/node_modules/nested/index.js",
+		"missing":               "",
+	}
+	for specifier, expected := range tests {
+		file, ok := resolveBareSpecifier(filepath.Join(dir, "src", "app"), specifier)
+		if expected == "" {
+			if ok {
+				t.Fatalf("Expected %s not to resolve, got %s", specifier, file)
+			}
+			continue
+		}
+		if !ok || file != filepath.Join(dir, filepath.FromSlash(expected)) {
+			t.Fatalf("Expected %s to resolve to %s, got %s (%v)", specifier, expected, file, ok)
+		}
+	}
+}
+
+func TestInjectImportMap(t *testing.T) {
+	imports := map[string]string{"lit": "/node_modules/lit/index.js", "own": "/node_modules/own/index.js"}
+	injected := string(injectImportMap([]byte(`<html><head><title>T</title></head></html>`), imports))
+	expected := `<html><head><script type="importmap">{"imports":{"lit":"/node_modules/lit/index.js","own":"/node_modules/own/index.js"}}</script><title>T</title></head></html>`
+	if injected != expected {
+		t.Fatalf("Expected %s, got %s", expected, injected)
+	}
+
+	merged := string(injectImportMap([]byte(`<script type="importmap">{"imports": {"own": "./own.js"}, "scopes": {}}</script>`), imports))
+	expected = `<script type="importmap">{"imports":{"lit":"/node_modules/lit/index.js","own":"./own.js"},"scopes":{}}</script>`
+	if merged != expected {
+		t.Fatalf("Expected %s, got %s", expected, merged)
+	}
+}
+
+func TestResolveModules(t *testing.T) {
+	project := t.TempDir()
+	writeFiles(t, project, map[string]string{
+		"node_modules/lit/package.json":               `{"module": "lit.js"}`,
+		"node_modules/lit/lit.js":                     `import "@lit/reactive-element";`,
+		"node_modules/@lit/reactive-element/index.js": "",
+		"src/index.html":                              `<html><head><script type="module" src="app.js"></script></head><body></body></html>`,
+		"src/app.js":                                  `import { html } from "lit";`,
+	})
+	htmlFile := filepath.Join(project, "src", "index.html")
+	config := withNodeModules(Config{ResolveModules: true}, filepath.Dir(htmlFile))
+
+	ts := httptest.NewServer(DevServer(htmlFile, config))
+	defer ts.Close()
+	resp, err := ts.Client().Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GET / failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	expected := `<script type="importmap">{"imports":{"@lit/reactive-element":"/__dotdev/node_modules/@lit/reactive-element/index.js","lit":"/__dotdev/node_modules/lit/lit.js"}}</script>`
+	if !strings.Contains(string(body), expected) {
+		t.Fatalf("Expected injected import map %s, got %s", expected, body)
+	}
+
+	resp, err = ts.Client().Get(ts.URL + "/__dotdev/node_modules/lit/lit.js")
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("Expected the package file to be served, got %v, %v", resp, err)
+	}
+	resp.Body.Close()
+
+	files := strings.Join(buildDependencyGraph(htmlFile, config).Files(), "\n")
+	if !strings.Contains(files, filepath.Join("node_modules", "@lit", "reactive-element", "index.js")) {
+		t.Fatalf("Expected resolved package files to be watched, got %s", files)
+	}
+}
+
+func TestImportMapCache(t *testing.T) {
+	project := t.TempDir()
+	writeFiles(t, project, map[string]string{
+		"node_modules/lit/package.json":   `{"module": "lit.js"}`,
+		"node_modules/lit/lit.js":         "",
+		"node_modules/three/package.json": `{"module": "three.js"}`,
+		"node_modules/three/three.js":     "",
+		"index.html":                      `<html><head><script type="module" src="app.js"></script></head><body></body></html>`,
+		"app.js":                          `import { html } from "lit";`,
+	})
+	htmlFile := filepath.Join(project, "index.html")
+	config := withNodeModules(Config{ResolveModules: true}, project)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go StartFileWatcher(ctx, htmlFile, config)
+	ts := httptest.NewServer(DevServer(htmlFile, config))
+	defer ts.Close()
+	if body := getHtmlContent(t, ts.URL+"/"); !strings.Contains(body, `"lit":"/node_modules/lit/lit.js"`) || strings.Contains(body, "three") {
+		t.Fatalf("Expected the import map to contain lit, got %s", body)
+	}
+
+	importMaps.Lock()
+	_, cached := importMaps.pages[htmlFile]
+	importMaps.Unlock()
+	if !cached {
+		t.Fatalf("Expected the import map of %s to be cached", htmlFile)
+	}
+
+	appFile := filepath.Join(project, "app.js")
+	os.WriteFile(appFile, []byte(`import { html } from "lit"; import * as THREE from "three";`), 0644)
+	newTime := time.Now().Add(2 * time.Second)
+	os.Chtimes(appFile, newTime, newTime)
+	// The watcher may see the file being written more than once.
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && !strings.Contains(getHtmlContent(t, ts.URL+"/"), `"three"`) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if body := getHtmlContent(t, ts.URL+"/"); !strings.Contains(body, `"three":"/node_modules/three/three.js"`) {
+		t.Fatalf("Expected the import map to be updated after the change, got %s", body)
+	}
+}
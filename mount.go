@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Mount maps a URL prefix to a directory served under it.
+type Mount struct {
+	Prefix string
+	Dir    string
+}
+
+// parseMount parses a mount specification of the form "/prefix=dir". The
+// directory is made absolute relative to the working directory.
+func parseMount(spec string) (Mount, error) {
+	prefix, dir, ok := strings.Cut(spec, "=")
+	if !ok || dir == "" {
+		return Mount{}, fmt.Errorf("invalid mount %q, expected /prefix=dir", spec)
+	}
+	prefix = path.Clean("/" + prefix)
+	if prefix == "/" {
+		return Mount{}, fmt.Errorf("invalid mount %q, prefix must not be the root", spec)
+	}
+	if isInternalPath(prefix) || isInternalPath(prefix+"/") {
+		return Mount{}, fmt.Errorf("invalid mount %q, prefix %s is reserved by dotdev", spec, prefix)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return Mount{}, fmt.Errorf("invalid mount %q: %w", spec, err)
+	}
+	return Mount{Prefix: prefix, Dir: absDir}, nil
+}
+
+// checkMounts returns an error when two mounts have the same prefix.
+func checkMounts(mounts []Mount) error {
+	dirs := map[string]string{}
+	for _, m := range mounts {
+		if dir, ok := dirs[m.Prefix]; ok {
+			return fmt.Errorf("mount %s is given twice, for %s and %s", m.Prefix, dir, m.Dir)
+		}
+		dirs[m.Prefix] = m.Dir
+	}
+	return nil
+}
+
+func (m Mount) String() string {
+	return fmt.Sprintf("%s=%s", m.Prefix, m.Dir)
+}
+
+// resolveMount returns the file a URL path refers to when it falls under one
+// of the mounts. The longest matching prefix wins, like in http.ServeMux.
+func resolveMount(mounts []Mount, urlPath string) (string, bool) {
+	urlPath = path.Clean("/" + urlPath)
+	var best *Mount
+	for i, m := range mounts {
+		if urlPath != m.Prefix && !strings.HasPrefix(urlPath, m.Prefix+"/") {
+			continue
+		}
+		if best == nil || len(m.Prefix) > len(best.Prefix) {
+			best = &mounts[i]
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	rel := strings.TrimPrefix(urlPath, best.Prefix)
+	return filepath.Join(best.Dir, filepath.FromSlash(rel)), true
+}
+
+// fileURLPath returns the URL path a file is served at, under the mount of the
+// directory holding it or under the serve root. It reports false for files
+// that are not served.
+func fileURLPath(root string, mounts []Mount, file string) (string, bool) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return "", false
+	}
+	var best *Mount
+	for i, m := range mounts {
+		if isUnderDir(file, m.Dir) && (best == nil || len(m.Dir) > len(best.Dir)) {
+			best = &mounts[i]
+		}
+	}
+	if best != nil {
+		rel, _ := filepath.Rel(best.Dir, file)
+		return path.Join(best.Prefix, filepath.ToSlash(rel)), true
+	}
+	root, err = filepath.Abs(root)
+	if err != nil || !isUnderDir(file, root) {
+		return "", false
+	}
+	rel, _ := filepath.Rel(root, file)
+	return path.Join("/", filepath.ToSlash(rel)), true
+}
+
+// isUnderDir reports whether the absolute path is in dir or one of its subdirectories.
+func isUnderDir(file string, dir string) bool {
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveURLPath returns the file a URL path is served from, either under one
+// of the mounts or under the serve root.
+func resolveURLPath(root string, mounts []Mount, urlPath string) string {
+	if mounted, ok := resolveMount(mounts, urlPath); ok {
+		return mounted
+	}
+	return filepath.Join(root, filepath.FromSlash(path.Clean("/"+urlPath)))
+}
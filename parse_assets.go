@@ -1,38 +1,86 @@
 package main
 
 import (
-	"os"
+	"net/url"
 	"path/filepath"
 	"regexp"
 	"strings"
 )
 
-// GetIncludedAssets parses the HTML file and returns any JS or CSS files referenced via
-// <script src="..."></script> or <link rel="stylesheet" href="...">. Returned paths
-// are absolute, resolved relative to the HTML file's directory.
-func GetIncludedAssets(htmlFile string) ([]string, error) {
-	data, err := os.ReadFile(htmlFile)
-	if err != nil {
-		return nil, err
-	}
-	content := string(data)
+var (
+	reScriptSrc      = regexp.MustCompile(`(?i)<script[^>]*\bsrc=["']([^"']+)["']`)
+	reStylesheetHref = regexp.MustCompile(`(?i)<link[^>]*\brel=["']?stylesheet["']?[^>]*\bhref=["']([^"']+)["']`)
+)
 
-	reScript := regexp.MustCompile(`(?i)<script[^>]*\bsrc=["']([^"']+)["']`)
-	reLink := regexp.MustCompile(`(?i)<link[^>]*\brel=["']?stylesheet["']?[^>]*\bhref=["']([^"']+)["']`)
+// documentURL returns the URL a file is served at, from the root directory
+// or one of the mounts. Other files are taken as served at the root.
+func documentURL(root string, mounts []Mount, file string) *url.URL {
+	if urlPath, ok := fileURLPath(root, mounts, file); ok {
+		return &url.URL{Path: urlPath}
+	}
+	return &url.URL{Path: "/" + filepath.Base(file)}
+}
 
-	var assets []string
-	for _, m := range reScript.FindAllStringSubmatch(content, -1) {
-		assets = append(assets, strings.TrimSpace(m[1]))
+// localReference resolves a reference against the URL of the document it
+// appears in. It reports false for references that are not served by dotdev:
+// remote and protocol-relative URLs, data: and other schemes. The query and
+// fragment are kept, only the path identifies the file.
+func localReference(base *url.URL, ref string) (*url.URL, bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil, false
 	}
-	for _, m := range reLink.FindAllStringSubmatch(content, -1) {
-		assets = append(assets, strings.TrimSpace(m[1]))
+	u, err := base.Parse(ref)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return nil, false
 	}
+	return u, true
+}
 
-	base := filepath.Dir(htmlFile)
-	for i, p := range assets {
-		if !filepath.IsAbs(p) {
-			assets[i] = filepath.Join(base, p)
+// srcsetCandidate is an image candidate of a srcset attribute.
+type srcsetCandidate struct {
+	URL        string
+	Descriptor string
+}
+
+// parseSrcset returns the candidates of a srcset attribute. Like in browsers,
+// a URL ends at whitespace and only then a comma ends the candidate, so the
+// commas of data: URLs are kept.
+func parseSrcset(srcset string) []srcsetCandidate {
+	const space = " \t\n\r\f"
+	var candidates []srcsetCandidate
+	for {
+		srcset = strings.TrimLeft(srcset, space+",")
+		if srcset == "" {
+			return candidates
+		}
+		end := strings.IndexAny(srcset, space)
+		if end < 0 {
+			end = len(srcset)
+		}
+		candidate := srcsetCandidate{URL: srcset[:end]}
+		srcset = srcset[end:]
+		if strings.HasSuffix(candidate.URL, ",") {
+			candidate.URL = strings.TrimRight(candidate.URL, ",")
+		} else {
+			// The descriptor ends at a comma outside parentheses.
+			depth, i := 0, 0
+		descriptor:
+			for ; i < len(srcset); i++ {
+				switch srcset[i] {
+				case '(':
+					depth++
+				case ')':
+					depth = max(depth-1, 0)
+				case ',':
+					if depth == 0 {
+						break descriptor
+					}
+				}
+			}
+			candidate.Descriptor = strings.TrimSpace(srcset[:i])
+			srcset = srcset[i:]
 		}
+		candidates = append(candidates, candidate)
 	}
-	return assets, nil
 }
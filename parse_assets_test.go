@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestResolveAssetFiles verifies that the references of a page resolve to the
+// files served for them, through the mounts and without query or fragment.
+func TestResolveAssetFiles(t *testing.T) {
+	root := t.TempDir()
+	vendor := t.TempDir()
+	htmlFile := filepath.Join(root, "index.html")
+	os.WriteFile(htmlFile, []byte(`<html><head>
+<link rel="stylesheet" href="/css/app.css">
+<link rel="stylesheet" href="theme.css?v=3#dark">
+<link rel="stylesheet" href="https://cdn.example.com/lib.css">
+<link rel="stylesheet" href="//cdn.example.com/other.css">
+<link rel="stylesheet" href="data:text/css,body{}">
+<script src="js/../js/app.js?v=1&amp;t=2"></script>
+<script src="../outside.js"></script>
+<script src="/vendor/lib.js"></script>
+<script src="my%20file.js"></script>
+</head></html>`), 0644)
+
+	files := buildDependencyGraph(htmlFile, Config{Mounts: []Mount{{Prefix: "/vendor", Dir: vendor}}}).Files()
+	expected := []string{
+		htmlFile,
+		filepath.Join(root, "css", "app.css"),
+		filepath.Join(root, "theme.css"),
+		filepath.Join(root, "js", "app.js"),
+		filepath.Join(root, "outside.js"),
+		filepath.Join(vendor, "lib.js"),
+		filepath.Join(root, "my file.js"),
+	}
+	if strings.Join(files, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected files\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(files, "\n"))
+	}
+}
+
+func TestResolveAssetFilesBaseHref(t *testing.T) {
+	root := t.TempDir()
+	htmlFile := filepath.Join(root, "index.html")
+	os.WriteFile(htmlFile, []byte(`<html><head>
+<base href="/static/">
+<link rel="stylesheet" href="app.css">
+<script src="/root.js"></script>
+</head></html>`), 0644)
+
+	files := buildDependencyGraph(htmlFile, Config{}).Files()
+	expected := []string{htmlFile, filepath.Join(root, "static", "app.css"), filepath.Join(root, "root.js")}
+	if !slices.Equal(files, expected) {
+		t.Fatalf("Expected files %v, got %v", expected, files)
+	}
+
+	os.WriteFile(htmlFile, []byte(`<base href="https://example.com/"><script src="app.js"></script>`), 0644)
+	if files := buildDependencyGraph(htmlFile, Config{}).Files(); len(files) != 1 {
+		t.Fatalf("Expected references under a remote base to be skipped, got %v", files)
+	}
+}
+
+func TestDocumentURL(t *testing.T) {
+	root := t.TempDir()
+	shared := t.TempDir()
+	mounts := []Mount{{Prefix: "/ui", Dir: shared}}
+	for file, expected := range map[string]string{
+		filepath.Join(root, "index.html"):         "/index.html",
+		filepath.Join(root, "docs", "guide.html"): "/docs/guide.html",
+		filepath.Join(shared, "docs", "ui.md"):    "/ui/docs/ui.md",
+		filepath.Join(root, "..", "other.html"):   "/other.html",
+	} {
+		if u := documentURL(root, mounts, file); u.Path != expected {
+			t.Fatalf("Expected %s to be served at %s, got %s", file, expected, u.Path)
+		}
+	}
+}
+
+func TestLocalReference(t *testing.T) {
+	tests := []struct {
+		base     string
+		ref      string
+		expected string
+	}{
+		{"/index.html", "/css/app.css", "/css/app.css"},
+		{"/index.html", " theme.css?v=3#dark ", "/theme.css?v=3#dark"},
+		{"/docs/index.html", "../js/../js/app.js", "/js/app.js"},
+		{"/index.html", "../outside.js", "/outside.js"},
+		{"/index.html", "my%20file.js", "/my%20file.js"},
+		{"/static/", "app.css", "/static/app.css"},
+		{"/index.html", "https://cdn.example.com/lib.css", ""},
+		{"/index.html", "//cdn.example.com/other.css", ""},
+		{"/index.html", "data:text/css,body{}", ""},
+		{"https://example.com/", "app.js", ""},
+		{"/index.html", "", ""},
+	}
+	for _, test := range tests {
+		base, _ := url.Parse(test.base)
+		u, ok := localReference(base, test.ref)
+		if test.expected == "" {
+			if ok {
+				t.Fatalf("Expected %q under %s not to be local, got %s", test.ref, test.base, u)
+			}
+			continue
+		}
+		if !ok || u.String() != test.expected {
+			t.Fatalf("Expected %q under %s to resolve to %s, got %v", test.ref, test.base, test.expected, u)
+		}
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	tests := []struct {
+		srcset   string
+		expected []srcsetCandidate
+	}{
+		{"img/a.png 1x, img/a@2x.png 2x", []srcsetCandidate{{"img/a.png", "1x"}, {"img/a@2x.png", "2x"}}},
+		{"a.png", []srcsetCandidate{{"a.png", ""}}},
+		{" a.png,, b.png 480w ,, c.png", []srcsetCandidate{{"a.png", ""}, {"b.png", "480w"}, {"c.png", ""}}},
+		{"data:image/png;base64,iVBOR= 1x, b.png 2x", []srcsetCandidate{{"data:image/png;base64,iVBOR=", "1x"}, {"b.png", "2x"}}},
+		{"a.png (x, y) 1x, b.png", []srcsetCandidate{{"a.png", "(x, y) 1x"}, {"b.png", ""}}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := parseSrcset(tt.srcset); !slices.Equal(got, tt.expected) {
+			t.Fatalf("Expected %q to have the candidates %v, got %v", tt.srcset, tt.expected, got)
+		}
+	}
+}
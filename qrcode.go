@@ -0,0 +1,469 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// This file implements a small QR code encoder, enough to show the server URL
+// in the terminal: byte mode, error correction level M and versions 1 to 10,
+// which hold up to 213 bytes.
+
+// qrMaxVersion is the largest supported QR code version.
+const qrMaxVersion = 10
+
+// qrECCPerBlock and qrBlocks are the error correction codewords per block and
+// the number of blocks of each version at error correction level M.
+var (
+	qrECCPerBlock = [qrMaxVersion + 1]int{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26}
+	qrBlocks      = [qrMaxVersion + 1]int{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5}
+)
+
+// qrCode is a QR code symbol, modules[y][x] is true for dark modules.
+type qrCode struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// encodeQR encodes text as a QR code with the smallest version that fits.
+func encodeQR(text string) (*qrCode, error) {
+	data := []byte(text)
+	version := 1
+	for ; version <= qrMaxVersion; version++ {
+		if qrDataBits(version, len(data)) <= qrDataCodewords(version)*8 {
+			break
+		}
+	}
+	if version > qrMaxVersion {
+		return nil, errors.New("text too long for a QR code")
+	}
+
+	codewords := qrAddECC(version, qrEncodeData(version, data))
+	q := newQRCode(version)
+	q.drawCodewords(codewords)
+
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		q.applyMask(mask)
+	}
+	q.applyMask(bestMask)
+	q.drawFormatBits(bestMask)
+	return q, nil
+}
+
+// qrDataBits is the number of bits needed to encode n bytes in byte mode.
+func qrDataBits(version int, n int) int {
+	return 4 + qrCountBits(version) + 8*n
+}
+
+func qrCountBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// qrRawCodewords is the number of codewords a version holds, data and error
+// correction together.
+func qrRawCodewords(version int) int {
+	modules := (16*version+128)*version + 64
+	if version >= 2 {
+		alignments := version/7 + 2
+		modules -= (25*alignments-10)*alignments - 55
+		if version >= 7 {
+			modules -= 36
+		}
+	}
+	return modules / 8
+}
+
+func qrDataCodewords(version int) int {
+	return qrRawCodewords(version) - qrECCPerBlock[version]*qrBlocks[version]
+}
+
+// qrEncodeData builds the data codewords: mode, length, data, terminator and padding.
+func qrEncodeData(version int, data []byte) []byte {
+	var bits []bool
+	appendBits := func(value int, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, value>>i&1 != 0)
+		}
+	}
+	appendBits(0b0100, 4)
+	appendBits(len(data), qrCountBits(version))
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+	capacity := qrDataCodewords(version) * 8
+	appendBits(0, min(4, capacity-len(bits)))
+	appendBits(0, (8-len(bits)%8)%8)
+
+	codewords := make([]byte, len(bits)/8, qrDataCodewords(version))
+	for i, bit := range bits {
+		if bit {
+			codewords[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	for pad := byte(0xEC); len(codewords) < cap(codewords); pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// qrAddECC splits the data into blocks, computes their error correction
+// codewords and interleaves everything.
+func qrAddECC(version int, data []byte) []byte {
+	numBlocks := qrBlocks[version]
+	eccLen := qrECCPerBlock[version]
+	raw := qrRawCodewords(version)
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw/numBlocks - eccLen
+	divisor := qrReedSolomonDivisor(eccLen)
+
+	var blocks, eccs [][]byte
+	for i, offset := 0, 0; i < numBlocks; i++ {
+		n := shortLen
+		if i >= numShort {
+			n++
+		}
+		block := data[offset : offset+n]
+		offset += n
+		blocks = append(blocks, block)
+		eccs = append(eccs, qrReedSolomonRemainder(block, divisor))
+	}
+
+	result := make([]byte, 0, raw)
+	for i := 0; i <= shortLen; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for _, ecc := range eccs {
+			result = append(result, ecc[i])
+		}
+	}
+	return result
+}
+
+// qrReedSolomonDivisor returns the generator polynomial of the given degree,
+// without its leading coefficient.
+func qrReedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrMultiply(root, 0x02)
+	}
+	return result
+}
+
+func qrReedSolomonRemainder(data []byte, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= qrMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// qrMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func qrMultiply(x byte, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// newQRCode returns a symbol of the given version with all function patterns
+// drawn: finder, timing and alignment patterns and the version information.
+func newQRCode(version int) *qrCode {
+	size := version*4 + 17
+	q := &qrCode{size: size}
+	q.modules = make([][]bool, size)
+	q.function = make([][]bool, size)
+	for y := range q.modules {
+		q.modules[y] = make([]bool, size)
+		q.function[y] = make([]bool, size)
+	}
+
+	for i := 0; i < size; i++ {
+		q.setFunction(6, i, i%2 == 0)
+		q.setFunction(i, 6, i%2 == 0)
+	}
+	q.drawFinder(3, 3)
+	q.drawFinder(size-4, 3)
+	q.drawFinder(3, size-4)
+
+	positions := qrAlignmentPositions[version]
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format information areas, drawn once the mask is chosen.
+	q.drawFormatBits(0)
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := bits>>i&1 != 0
+			a, b := size-11+i%3, i/3
+			q.setFunction(a, b, dark)
+			q.setFunction(b, a, dark)
+		}
+	}
+	return q
+}
+
+// qrAlignmentPositions are the centers of the alignment patterns of each version.
+var qrAlignmentPositions = [qrMaxVersion + 1][]int{
+	nil, nil,
+	{6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34},
+	{6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50},
+}
+
+func (q *qrCode) setFunction(x int, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+func (q *qrCode) drawFinder(x int, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx >= 0 && xx < q.size && yy >= 0 && yy < q.size {
+				dist := max(abs(dx), abs(dy))
+				q.setFunction(xx, yy, dist != 2 && dist != 4)
+			}
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the format information for level M.
+func (q *qrCode) drawFormatBits(mask int) {
+	data := mask // level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		q.setFunction(8, i, bit(i))
+	}
+	q.setFunction(8, 7, bit(6))
+	q.setFunction(8, 8, bit(7))
+	q.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunction(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.setFunction(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunction(8, q.size-15+i, bit(i))
+	}
+	q.setFunction(8, q.size-8, true)
+}
+
+// drawCodewords places the codewords in the zigzag order of the standard.
+func (q *qrCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(codewords)*8 {
+					q.modules[y][x] = codewords[i/8]>>(7-i%8)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by the mask pattern. Applying
+// the same mask twice undoes it.
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol by the rules of the standard, lower is easier to read.
+func (q *qrCode) penalty() int {
+	penalty := 0
+	line := make([]bool, q.size)
+	for _, horizontal := range []bool{true, false} {
+		for i := 0; i < q.size; i++ {
+			for j := 0; j < q.size; j++ {
+				if horizontal {
+					line[j] = q.modules[i][j]
+				} else {
+					line[j] = q.modules[j][i]
+				}
+			}
+			penalty += qrLinePenalty(line)
+		}
+	}
+
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < q.size && y+1 < q.size {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+	total := q.size * q.size
+	penalty += abs(dark*20-total*10) / total * 10
+	return penalty
+}
+
+// qrLinePenalty scores runs of the same color and finder-like patterns in a row
+// or column.
+func qrLinePenalty(line []bool) int {
+	penalty := 0
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			penalty += run - 2
+		}
+		run = 1
+	}
+	pattern := []bool{true, false, true, true, true, false, true}
+	light := func(from int, to int) bool {
+		for i := from; i < to; i++ {
+			if i >= 0 && i < len(line) && line[i] {
+				return false
+			}
+		}
+		return true
+	}
+	for i := 0; i+len(pattern) <= len(line); i++ {
+		matches := true
+		for j, dark := range pattern {
+			if line[i+j] != dark {
+				matches = false
+				break
+			}
+		}
+		if matches && (light(i-4, i) || light(i+7, i+11)) {
+			penalty += 40
+		}
+	}
+	return penalty
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// String renders the symbol with half blocks, two rows per line, surrounded by
+// a quiet zone. Light modules are drawn, so the code reads correctly on the
+// dark background of most terminals.
+func (q *qrCode) String() string {
+	const quiet = 2
+	light := func(x int, y int) bool {
+		x, y = x-quiet, y-quiet
+		if x < 0 || y < 0 || x >= q.size || y >= q.size {
+			return true
+		}
+		return !q.modules[y][x]
+	}
+	var b strings.Builder
+	for y := 0; y < q.size+2*quiet; y += 2 {
+		for x := 0; x < q.size+2*quiet; x++ {
+			top, bottom := light(x, y), y+1 < q.size+2*quiet && light(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestEncodeQR checks the structure of an encoded symbol: its size, the finder
+// patterns and the format information, which must match in both copies.
+func TestEncodeQR(t *testing.T) {
+	q, err := encodeQR("http://192.168.1.20:4774")
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if q.size != 25 {
+		t.Fatalf("Expected a version 2 symbol of 25 modules, got %d", q.size)
+	}
+	for _, corner := range [][2]int{{0, 0}, {q.size - 7, 0}, {0, q.size - 7}} {
+		for i := 0; i < 7; i++ {
+			x, y := corner[0]+i, corner[1]
+			if !q.modules[y][x] || !q.modules[y+6][x] || !q.modules[corner[1]+i][corner[0]] {
+				t.Fatalf("Expected finder pattern border at %v", corner)
+			}
+		}
+	}
+
+	var first, second int
+	for i := 0; i <= 5; i++ {
+		first |= boolBit(q.modules[i][8]) << i
+	}
+	first |= boolBit(q.modules[7][8])<<6 | boolBit(q.modules[8][8])<<7 | boolBit(q.modules[8][7])<<8
+	for i := 9; i < 15; i++ {
+		first |= boolBit(q.modules[8][14-i]) << i
+	}
+	for i := 0; i < 8; i++ {
+		second |= boolBit(q.modules[8][q.size-1-i]) << i
+	}
+	for i := 8; i < 15; i++ {
+		second |= boolBit(q.modules[q.size-15+i][8]) << i
+	}
+	if first != second {
+		t.Fatalf("Expected both format information copies to match, got %015b and %015b", first, second)
+	}
+	if level := (first ^ 0x5412) >> 13; level != 0 {
+		t.Fatalf("Expected error correction level M, got %02b", level)
+	}
+
+	rendered := q.String()
+	if lines := strings.Count(rendered, "\n"); lines != (q.size+4+1)/2 {
+		t.Fatalf("Expected %d lines, got %d", (q.size+4+1)/2, lines)
+	}
+
+	if _, err := encodeQR(strings.Repeat("x", 214)); err == nil {
+		t.Fatalf("Expected error for text over the capacity")
+	}
+}
+
+func TestQRReedSolomon(t *testing.T) {
+	// The example of the standard: "01234567" at version 1-M.
+	data := []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	want := []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55}
+	got := qrReedSolomonRemainder(data, qrReedSolomonDivisor(10))
+	if string(got) != string(want) {
+		t.Fatalf("Expected error correction codewords %x, got %x", want, got)
+	}
+}
+
+func boolBit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RedirectRule is a single line of a _redirects file, as used by Netlify and
+// Cloudflare Pages:
+//
+//	/from/:placeholder/*  /to/:placeholder/:splat  301!
+type RedirectRule struct {
+	From string
+	To   string
+	// Query lists query parameter conditions, mapping parameter names to placeholders.
+	Query  map[string]string
+	Status int
+	// Force applies the rule even when a file exists at the requested path.
+	Force bool
+	Line  int
+}
+
+func (rule RedirectRule) String() string {
+	force := ""
+	if rule.Force {
+		force = "!"
+	}
+	return fmt.Sprintf("_redirects:%d %s %s %d%s", rule.Line, rule.From, rule.To, rule.Status, force)
+}
+
+// parseRedirects parses the contents of a _redirects file. Blank lines and
+// lines starting with # are ignored, the status defaults to 301.
+func parseRedirects(data []byte) ([]RedirectRule, error) {
+	var rules []RedirectRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a source and a destination", lineNo)
+		}
+		rule := RedirectRule{From: fields[0], Status: http.StatusMovedPermanently, Line: lineNo}
+		rest := fields[1:]
+		for len(rest) > 0 && strings.Contains(rest[0], "=") && !strings.Contains(rest[0], "/") {
+			name, placeholder, _ := strings.Cut(rest[0], "=")
+			if rule.Query == nil {
+				rule.Query = map[string]string{}
+			}
+			rule.Query[name] = placeholder
+			rest = rest[1:]
+		}
+		if len(rest) == 0 {
+			return nil, fmt.Errorf("line %d: missing destination", lineNo)
+		}
+		rule.To = rest[0]
+		rest = rest[1:]
+		if len(rest) > 0 {
+			status := rest[0]
+			if strings.HasSuffix(status, "!") {
+				rule.Force = true
+				status = strings.TrimSuffix(status, "!")
+			}
+			code, err := strconv.Atoi(status)
+			if err != nil || code < 200 || code > 599 {
+				return nil, fmt.Errorf("line %d: invalid status %q", lineNo, rest[0])
+			}
+			rule.Status = code
+			rest = rest[1:]
+		}
+		if len(rest) > 0 {
+			return nil, fmt.Errorf("line %d: unexpected %q", lineNo, strings.Join(rest, " "))
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// Match reports whether the rule applies to the URL and returns its destination
+// with placeholders and the splat substituted.
+func (rule RedirectRule) Match(u *url.URL) (string, bool) {
+	params, ok := matchPathPattern(rule.From, u.Path)
+	if !ok {
+		return "", false
+	}
+	query := u.Query()
+	for name, placeholder := range rule.Query {
+		value := query.Get(name)
+		if value == "" {
+			return "", false
+		}
+		if strings.HasPrefix(placeholder, ":") {
+			params[placeholder[1:]] = value
+		}
+	}
+
+	to := rePlaceholder.ReplaceAllStringFunc(rule.To, func(placeholder string) string {
+		if value, ok := params[placeholder[1:]]; ok {
+			return value
+		}
+		return placeholder
+	})
+	return to, true
+}
+
+var rePlaceholder = regexp.MustCompile(`:[A-Za-z_][A-Za-z0-9_]*`)
+
+// matchPathPattern matches a path against a pattern made of literal segments,
+// :placeholder segments and an optional trailing * splat. Trailing slashes are
+// ignored. The captured values are returned by name, the splat as "splat".
+func matchPathPattern(pattern string, urlPath string) (map[string]string, bool) {
+	params := map[string]string{}
+	patternSegments := splitPath(pattern)
+	pathSegments := splitPath(urlPath)
+	for i, segment := range patternSegments {
+		if segment == "*" && i == len(patternSegments)-1 {
+			if i < len(pathSegments) {
+				params["splat"] = strings.Join(pathSegments[i:], "/")
+			} else {
+				params["splat"] = ""
+			}
+			return params, true
+		}
+		if i >= len(pathSegments) {
+			return nil, false
+		}
+		if strings.HasPrefix(segment, ":") {
+			params[segment[1:]] = pathSegments[i]
+			continue
+		}
+		if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+	return params, len(patternSegments) == len(pathSegments)
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// redirectsHandler applies the rules of a _redirects file before passing requests
+// to next. Unless forced, a rule does not apply when the requested path exists,
+// as with Netlify's shadowing. Status 200 rewrites the request, 404 serves the
+// destination as a not-found page and 3xx redirects the client.
+func redirectsHandler(
+	rules *reloadingFile[[]RedirectRule],
+	exists func(urlPath string) bool,
+	verbose bool,
+	next http.Handler,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isInternalPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, rule := range rules.Get() {
+			target, ok := rule.Match(r.URL)
+			if !ok {
+				continue
+			}
+			if !rule.Force && exists(r.URL.Path) {
+				continue
+			}
+			if verbose {
+				ServerState.RecordEvent("redirect", fmt.Sprintf("%s %s matched %s -> %s", r.Method, r.URL.RequestURI(), rule, target),
+					slog.String("path", r.URL.RequestURI()),
+					slog.String("rule", rule.String()),
+					slog.String("target", target),
+				)
+			}
+			applyRedirectRule(w, r, rule, target, next)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func applyRedirectRule(w http.ResponseWriter, r *http.Request, rule RedirectRule, target string, next http.Handler) {
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid destination in %s", rule), http.StatusInternalServerError)
+		return
+	}
+	if targetURL.RawQuery == "" {
+		targetURL.RawQuery = r.URL.RawQuery
+	}
+
+	if rule.Status >= 300 && rule.Status < 400 {
+		http.Redirect(w, r, targetURL.String(), rule.Status)
+		return
+	}
+
+	if targetURL.IsAbs() {
+		proxy := &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(targetURL)
+				pr.Out.URL.Path = targetURL.Path
+				pr.Out.URL.RawPath = targetURL.RawPath
+				pr.Out.URL.RawQuery = targetURL.RawQuery
+			},
+		}
+		proxy.ServeHTTP(statusWriter(w, rule.Status), r)
+		return
+	}
+
+	rewritten := r.Clone(r.Context())
+	rewritten.URL.Path = targetURL.Path
+	rewritten.URL.RawPath = ""
+	rewritten.URL.RawQuery = targetURL.RawQuery
+	rewritten.RequestURI = rewritten.URL.RequestURI()
+	next.ServeHTTP(statusWriter(w, rule.Status), rewritten)
+}
+
+// statusWriter returns w, or a wrapper of it replacing a successful status
+// with the given one, used for rules like "/* /404.html 404".
+func statusWriter(w http.ResponseWriter, status int) http.ResponseWriter {
+	if status == http.StatusOK {
+		return w
+	}
+	return &overrideStatusWriter{ResponseWriter: w, status: status}
+}
+
+type overrideStatusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *overrideStatusWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code == http.StatusOK {
+		code = w.status
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *overrideStatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *overrideStatusWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseRedirects verifies parsing of statuses, forced rules and query conditions.
+func TestParseRedirects(t *testing.T) {
+	rules, err := parseRedirects([]byte(`
+# comment
+/old /new
+/blog/*  /posts/:splat  302!
+/store id=:id  /products/:id  200
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse redirects: %v", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(rules))
+	}
+	if rules[0].Status != 301 || rules[0].Force {
+		t.Errorf("Expected default status 301, got %+v", rules[0])
+	}
+	if rules[1].Status != 302 || !rules[1].Force || rules[1].Line != 4 {
+		t.Errorf("Expected forced 302 on line 4, got %+v", rules[1])
+	}
+	if rules[2].Query["id"] != ":id" || rules[2].To != "/products/:id" {
+		t.Errorf("Expected query condition, got %+v", rules[2])
+	}
+
+	if _, err := parseRedirects([]byte("/a /b abc")); err == nil {
+		t.Errorf("Expected error for invalid status")
+	}
+}
+
+// TestRedirectRuleMatch verifies splat and placeholder substitution.
+func TestRedirectRuleMatch(t *testing.T) {
+	cases := []struct {
+		rule RedirectRule
+		url  string
+		want string
+		ok   bool
+	}{
+		{RedirectRule{From: "/blog/*", To: "/posts/:splat"}, "/blog/2024/hello", "/posts/2024/hello", true},
+		{RedirectRule{From: "/blog/*", To: "/posts/:splat"}, "/blog", "/posts/", true},
+		{RedirectRule{From: "/u/:name/edit", To: "/edit?user=:name"}, "/u/ann/edit/", "/edit?user=ann", true},
+		{RedirectRule{From: "/u/:name/edit", To: "/users/:name"}, "/u/ann/edit", "/users/ann", true},
+		{RedirectRule{From: "/u/:name", To: "/users/:name"}, "/u/ann/edit", "", false},
+		{RedirectRule{From: "/store", To: "/products/:id", Query: map[string]string{"id": ":id"}}, "/store?id=7", "/products/7", true},
+		{RedirectRule{From: "/store", To: "/products/:id", Query: map[string]string{"id": ":id"}}, "/store", "", false},
+	}
+	for _, c := range cases {
+		u, _ := url.Parse(c.url)
+		got, ok := c.rule.Match(u)
+		if ok != c.ok || got != c.want {
+			t.Errorf("%s on %s: expected (%q, %v), got (%q, %v)", c.rule.From, c.url, c.want, c.ok, got, ok)
+		}
+	}
+}
+
+// TestRedirectsHandler verifies redirects, rewrites, shadowing and hot reloading of _redirects.
+func TestRedirectsHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	htmlPath := filepath.Join(tmpDir, "index.html")
+	redirectsPath := filepath.Join(tmpDir, "_redirects")
+	os.WriteFile(htmlPath, []byte(`<html><body>Entry</body></html>`), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "about.html"), []byte("About"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "404.html"), []byte("Missing"), 0644)
+	os.WriteFile(redirectsPath, []byte(`
+/old/*        /about.html  302
+/about.html   /index.html  301
+/app/*        /index.html  200
+/nowhere/*    /404.html    404
+`), 0644)
+
+	ts := httptest.NewServer(DevServer(htmlPath, Config{}))
+	defer ts.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	get := func(path string) (*http.Response, string) {
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	if resp, _ := get("/old/page?x=1"); resp.StatusCode != 302 || resp.Header.Get("Location") != "/about.html?x=1" {
+		t.Fatalf("Expected 302 to /about.html?x=1, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if resp, body := get("/about.html"); resp.StatusCode != 200 || body != "About" {
+		t.Fatalf("Expected existing file to shadow unforced rule, got %d %q", resp.StatusCode, body)
+	}
+	if resp, body := get("/app/settings"); resp.StatusCode != 200 || !strings.Contains(body, "Entry") || !strings.Contains(body, "WebSocket") {
+		t.Fatalf("Expected rewrite to injected index, got %d %q", resp.StatusCode, body)
+	}
+	if resp, body := get("/nowhere/x"); resp.StatusCode != 404 || body != "Missing" {
+		t.Fatalf("Expected custom 404 page, got %d %q", resp.StatusCode, body)
+	}
+
+	os.WriteFile(redirectsPath, []byte("/about.html /index.html 301!\n"), 0644)
+	newTime := time.Now().Add(2 * time.Second)
+	os.Chtimes(redirectsPath, newTime, newTime)
+	if resp, _ := get("/about.html"); resp.StatusCode != 301 || resp.Header.Get("Location") != "/index.html" {
+		t.Fatalf("Expected reloaded forced rule to redirect, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
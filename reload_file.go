@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// reloadingFile holds the parsed contents of a configuration file. It is
+// parsed on first use and again whenever its modification time changes, so
+// edits apply to the next request without restarting the server.
+type reloadingFile[T any] struct {
+	path  string
+	parse func([]byte) (T, error)
+
+	mu      sync.Mutex
+	modTime time.Time
+	value   T
+}
+
+func newReloadingFile[T any](path string, parse func([]byte) (T, error)) *reloadingFile[T] {
+	return &reloadingFile[T]{path: path, parse: parse}
+}
+
+// Get returns the current parsed value. A missing file yields the zero value,
+// a file that fails to parse keeps the previously loaded value.
+func (f *reloadingFile[T]) Get() T {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		var zero T
+		f.value = zero
+		f.modTime = time.Time{}
+		return f.value
+	}
+	if info.ModTime().Equal(f.modTime) {
+		return f.value
+	}
+	f.modTime = info.ModTime()
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		log.Printf("Error reading %s: %v\n", f.path, err)
+		return f.value
+	}
+	value, err := f.parse(data)
+	if err != nil {
+		log.Printf("Error parsing %s: %v\n", f.path, err)
+		return f.value
+	}
+	f.value = value
+	return f.value
+}
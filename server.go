@@ -1,82 +1,366 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
+// DevServer returns the handler of the dev server for the HTML file, without
+// an access log file.
 func DevServer(
 	htmlFile string,
+	config Config,
+) http.Handler {
+	return newDevServer(htmlFile, config, nil)
+}
+
+// newDevServer returns the handler of the dev server, writing every request
+// to accessLog, if any.
+func newDevServer(
+	htmlFile string,
+	config Config,
+	accessLog *accessLogWriter,
 ) http.Handler {
 	mux := http.NewServeMux()
-	idxHandler := indexHandler(htmlFile)
+	servePage := indexHandler(htmlFile, config)
 	baseDir := filepath.Dir(htmlFile)
 	fileServer := http.FileServer(http.Dir(baseDir))
+	exists := func(urlPath string) bool {
+		return fileExists(resolveURLPath(baseDir, config.Mounts, urlPath))
+	}
 
 	mux.HandleFunc("/ws", wsHandler)
+	mux.HandleFunc(internalPathPrefix+"status", statusHandler)
+	mux.HandleFunc(internalPathPrefix+"metrics", metricsPromHandler)
+	mux.HandleFunc(internalPathPrefix+"deps", dependencyGraphHandler(htmlFile, config))
+	mux.HandleFunc(internalPathPrefix, dashboardHandler())
+	// serveRenderedPage serves the other pages dotdev renders, and watches
+	// them once served.
+	serveRenderedPage := func(w http.ResponseWriter, r *http.Request) bool {
+		page, content := renderedPage(baseDir, r.URL.Path, config)
+		if page == "" {
+			return false
+		}
+		watchPage(page)
+		servePage(w, r, page, content)
+		return true
+	}
+	for _, m := range config.Mounts {
+		mountServer := http.StripPrefix(m.Prefix, http.FileServer(http.Dir(m.Dir)))
+		mux.HandleFunc(m.Prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+			if !serveRenderedPage(w, r) {
+				mountServer.ServeHTTP(w, r)
+			}
+		})
+	}
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/" {
-			idxHandler(w, r)
+		if isIndexPath(r.URL.Path, htmlFile) {
+			servePage(w, r, htmlFile, nil)
+			return
+		}
+		if serveRenderedPage(w, r) {
+			return
+		}
+		if config.SPA && isSPARoute(r) && !exists(r.URL.Path) {
+			servePage(w, r, htmlFile, nil)
 			return
 		}
 		fileServer.ServeHTTP(w, r)
 	})
-	return mux
+
+	redirects := newReloadingFile(filepath.Join(baseDir, "_redirects"), parseRedirects)
+	headers := newReloadingFile(filepath.Join(baseDir, "_headers"), parseHeaders)
+	handler := headersHandler(headers, config.Headers, redirectsHandler(redirects, exists, config.Verbose, mux))
+	return accessLogHandler(accessLog, metricsHandler(handler))
 }
 
-func StartFileWatcher(filePath string) {
-	lower := strings.ToLower(filePath)
-	if strings.HasSuffix(lower, ".html") || strings.HasSuffix(lower, ".htm") {
-		if assets, err := GetIncludedAssets(filePath); err == nil {
-			for _, a := range assets {
-				go StartFileWatcher(a)
+// internalPathPrefix is the URL prefix of the endpoints provided by dotdev itself.
+const internalPathPrefix = "/__dotdev/"
+
+// isInternalPath reports whether the URL path is handled by dotdev itself rather
+// than served from the file system, so routing rules do not apply to it.
+func isInternalPath(urlPath string) bool {
+	return urlPath == "/ws" || strings.HasPrefix(urlPath, internalPathPrefix)
+}
+
+// isIndexPath reports whether the URL path refers to the served HTML file, either
+// as the root or by its file name.
+func isIndexPath(urlPath string, htmlFile string) bool {
+	return urlPath == "/" || urlPath == "/"+filepath.Base(htmlFile)
+}
+
+// servedPages collects the pages served besides the entry file, such as
+// other Markdown files, until the file watcher adds their dependencies.
+var servedPages = struct {
+	sync.Mutex
+	pending map[string]bool
+	// watchers are signaled when pages are added.
+	watchers map[chan struct{}]struct{}
+}{pending: map[string]bool{}, watchers: map[chan struct{}]struct{}{}}
+
+// watchPage asks the file watcher to watch a served page and its dependencies.
+func watchPage(file string) {
+	servedPages.Lock()
+	defer servedPages.Unlock()
+	servedPages.pending[file] = true
+	for added := range servedPages.watchers {
+		select {
+		case added <- struct{}{}:
+		default:
+			// The watcher has not taken the previous pages yet and takes this
+			// one with them.
+		}
+	}
+}
+
+// subscribeServedPages returns a channel signaled when pages are served,
+// until the returned function is called.
+func subscribeServedPages() (<-chan struct{}, func()) {
+	added := make(chan struct{}, 1)
+	servedPages.Lock()
+	servedPages.watchers[added] = struct{}{}
+	servedPages.Unlock()
+	// Pages may have been served before.
+	added <- struct{}{}
+	return added, func() {
+		servedPages.Lock()
+		defer servedPages.Unlock()
+		delete(servedPages.watchers, added)
+	}
+}
+
+// takeServedPages returns the pages served from the root directory or the
+// mounts since the last call.
+func takeServedPages(root string, mounts []Mount) []string {
+	servedPages.Lock()
+	defer servedPages.Unlock()
+	var pages []string
+	for page := range servedPages.pending {
+		if _, ok := fileURLPath(root, mounts, page); ok {
+			pages = append(pages, page)
+			delete(servedPages.pending, page)
+		}
+	}
+	return pages
+}
+
+// StartFileWatcher watches the file and the files it depends on until the
+// context is canceled, reloading the connected clients on changes. The
+// dependency graph of the pages depending on a changed file is scanned again,
+// so files referenced by an edit are watched too. Pages served later with
+// watchPage are added, and forgotten once their file is deleted. With
+// --template, templates and data files added later are watched too.
+func StartFileWatcher(ctx context.Context, filePath string, config Config) {
+	defer restoreTerminalOnPanic()
+	root := filepath.Dir(filePath)
+	var mu sync.Mutex
+	// pages maps the watched pages to the files they depend on.
+	pages := map[string]map[string]bool{}
+	var watch func(file string)
+	scan := func(page string) {
+		graph := buildPageDependencyGraph(root, page, config)
+		if config.ResolveModules {
+			updateImportMap(page, graph.moduleImports)
+		}
+		files := map[string]bool{}
+		for _, file := range graph.Files() {
+			files[file] = true
+		}
+		mu.Lock()
+		if page != filePath && !fileExists(page) {
+			delete(pages, page)
+		} else {
+			pages[page] = files
+		}
+		mu.Unlock()
+		for file := range files {
+			watch(file)
+		}
+	}
+	// rescan scans the pages depending on the changed file again, or all of
+	// them when changed is empty.
+	rescan := func(changed string) {
+		var affected []string
+		mu.Lock()
+		for page, files := range pages {
+			if changed == "" || page == changed || files[changed] {
+				affected = append(affected, page)
 			}
 		}
+		mu.Unlock()
+		for _, page := range affected {
+			scan(page)
+		}
 	}
+	watch = func(file string) {
+		if !watchedFiles.Add(file) {
+			return
+		}
+		onChange := func() {
+			defer restoreTerminalOnPanic()
+			if ctx.Err() != nil {
+				return
+			}
+			watchedFiles.Changed(file)
+			ServerState.RecordEvent("change", file, slog.String("file", file))
+			rescan(file)
+			broadcastReload()
+		}
+		go watchFile(ctx, file, onChange)
+	}
+	added, unsubscribe := subscribeServedPages()
+	defer unsubscribe()
+	scan(filePath)
+	if config.Template {
+		// New templates and data files are available to every page.
+		go watchTemplateFiles(ctx, root, func() {
+			if ctx.Err() != nil {
+				return
+			}
+			watchedFiles.Changed(root)
+			ServerState.RecordEvent("change", "Templates or data files added or removed", slog.String("dir", root))
+			rescan("")
+			broadcastReload()
+		})
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-added:
+			for _, page := range takeServedPages(root, config.Mounts) {
+				mu.Lock()
+				_, known := pages[page]
+				mu.Unlock()
+				if !known {
+					scan(page)
+				}
+			}
+		}
+	}
+}
+
+// watchFile calls onChange when the file changes, until the context is canceled.
+func watchFile(ctx context.Context, file string, onChange func()) {
+	defer restoreTerminalOnPanic()
 	if runtime.GOOS == "linux" {
-		watchFileInotify(filePath, Throttle(broadcastReload, 100*time.Millisecond))
+		watchFileInotify(ctx, file, Throttle(onChange, 100*time.Millisecond))
 	}
-	watchFilePoll(filePath, broadcastReload)
+	watchFilePoll(ctx, file, onChange)
 }
 
+// StartDevServer serves the HTML file until the context is canceled, then
+// shuts the server down gracefully.
 func StartDevServer(
-	host string,
-	port int,
+	ctx context.Context,
 	htmlFile string,
+	config Config,
+	accessLog *accessLogWriter,
 ) {
-	ServerState.StartedAt = time.Now()
-	ServerState.ServePath = htmlFile
-	ServerState.Urls = []string{fmt.Sprintf("http://%s:%d", host, port)}
-	notifyServerStateUpdate()
-	go StartFileWatcher(htmlFile)
-	server := DevServer(htmlFile)
-	addr := fmt.Sprintf("%s:%d", host, port)
-	if err := http.ListenAndServe(addr, server); err != nil {
+	listeners, err := openListeners(config)
+	if err != nil {
+		restoreTerminal()
+		log.Fatal(err)
+	}
+	var urls, lanURLs []string
+	for _, l := range listeners {
+		urls = append(urls, l.urls...)
+		lanURLs = append(lanURLs, l.lanURLs...)
+	}
+	ServerState.Update(func(state *State) {
+		state.StartedAt = time.Now()
+		state.ServePath = htmlFile
+		state.Urls = urls
+		if len(lanURLs) > 0 {
+			state.LANURL = lanURLs[0]
+		}
+	})
+	ServerState.RecordEvent("serving", fmt.Sprintf("dotdev serving %s from %s on %s", htmlFile, filepath.Dir(htmlFile), strings.Join(urls, " ")),
+		slog.String("file", htmlFile),
+		slog.String("dir", filepath.Dir(htmlFile)),
+		slog.Any("urls", urls),
+	)
+	if err := writeURLFile(config.URLFile, urls[0]); err != nil {
+		log.Printf("Error writing URL file: %v\n", err)
+	}
+	go StartFileWatcher(ctx, htmlFile, config)
+	go watchReferences(ctx, htmlFile, config)
+	server := &http.Server{
+		Handler: newDevServer(htmlFile, config, accessLog),
+	}
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func() {
+			errs <- server.Serve(l)
+		}()
+	}
+	select {
+	case err := <-errs:
+		restoreTerminal()
 		log.Printf("Unrecoverable error: %v", err)
 		log.Fatal(err)
+	case <-ctx.Done():
+		shutdownServer(server)
+		if config.URLFile != "" {
+			os.Remove(config.URLFile)
+		}
 	}
 }
 
-// broadcastReload sends a "reload" message to all connected WebSocket clients.
+// broadcastReload reloads the connected clients after a file change, unless
+// reloads are paused.
 func broadcastReload() {
-	ServerState.NoUpdates += 1
-	notifyServerStateUpdate()
+	if ServerState.IsPaused() {
+		ServerState.RecordEvent("skip", "Reload skipped, reloads are paused")
+		return
+	}
+	forceReload()
+}
+
+// forceReload sends a "reload" message to all connected WebSocket clients.
+func forceReload() {
+	ServerState.IncUpdates()
 	wsMutex.Lock()
 	defer wsMutex.Unlock()
+	defer func() { ServerState.SetConnectedClients(countPageClients()) }()
 	for i := 0; i < len(wsClients); {
-		conn := wsClients[i]
-		err := sendPayload(conn, []byte("reload"))
+		client := wsClients[i]
+		if client.dashboard {
+			i++
+			continue
+		}
+		err := sendPayload(client.conn, []byte("reload"))
 		if err != nil {
 			log.Printf("Error sending reload message: %v\n", err)
-			conn.Close()
+			client.conn.Close()
 			wsClients = append(wsClients[:i], wsClients[i+1:]...)
 		} else {
 			i++
 		}
 	}
 }
+
+// togglePause pauses or resumes reloads on file changes and returns whether
+// they are paused now.
+func togglePause() bool {
+	var paused bool
+	ServerState.Update(func(state *State) {
+		state.Paused = !state.Paused
+		paused = state.Paused
+	})
+	if paused {
+		ServerState.RecordEvent("pause", "Reloads paused")
+	} else {
+		ServerState.RecordEvent("resume", "Reloads resumed")
+	}
+	return paused
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -31,8 +33,8 @@ func TestLiveReload(t *testing.T) {
 	}
 
 	indexPath := path.Join(tmpDir, "index.html")
-	handler := DevServer(indexPath)
-	go StartFileWatcher(filePath)
+	handler := DevServer(indexPath, Config{})
+	go StartFileWatcher(context.Background(), filePath, Config{})
 	ts := httptest.NewServer(handler)
 	defer ts.Close()
 
@@ -102,8 +104,8 @@ func TestReloadOnAssetChange(t *testing.T) {
 	os.WriteFile(cssPath, []byte("body{}"), 0644)
 	os.WriteFile(jsPath, []byte("console.log('hi')"), 0644)
 
-	handler := DevServer(htmlPath)
-	go StartFileWatcher(htmlPath)
+	handler := DevServer(htmlPath, Config{})
+	go StartFileWatcher(context.Background(), htmlPath, Config{})
 	ts := httptest.NewServer(handler)
 	defer ts.Close()
 
@@ -129,6 +131,44 @@ func TestReloadOnAssetChange(t *testing.T) {
 	}
 }
 
+// TestReloadOnCreatedAsset ensures that creating a file referenced before it
+// exists reloads the page.
+func TestReloadOnCreatedAsset(t *testing.T) {
+	dir := t.TempDir()
+	htmlPath := filepath.Join(dir, "index.html")
+	cssPath := filepath.Join(dir, "late.css")
+	writeFiles(t, dir, map[string]string{"index.html": `<link rel="stylesheet" href="late.css">`})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go StartFileWatcher(ctx, htmlPath, Config{})
+	ts := httptest.NewServer(DevServer(htmlPath, Config{}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	wsConn := dialWebSocket(t, u.Host)
+	defer wsConn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !slices.ContainsFunc(watchedFiles.List(), func(f WatchedFile) bool { return f.Path == cssPath }) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the missing %s to be watched", cssPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	os.WriteFile(cssPath, []byte("body{}"), 0644)
+
+	done := make(chan string, 1)
+	go func() { done <- readWebSocketMessage(t, wsConn) }()
+	select {
+	case msg := <-done:
+		if msg != "reload" {
+			t.Fatalf("Expected 'reload' message, got: %q", msg)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for reload message after creating the file")
+	}
+}
+
 // TestServeAssets ensures that referenced CSS and JS files are served correctly.
 func TestServeAssets(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "serve-assets-test")
@@ -148,7 +188,7 @@ func TestServeAssets(t *testing.T) {
 	os.WriteFile(cssPath, []byte(cssData), 0644)
 	os.WriteFile(jsPath, []byte(jsData), 0644)
 
-	handler := DevServer(htmlPath)
+	handler := DevServer(htmlPath, Config{})
 	ts := httptest.NewServer(handler)
 	defer ts.Close()
 
@@ -179,6 +219,97 @@ func TestServeAssets(t *testing.T) {
 	}
 }
 
+// TestSPAFallback verifies that unknown HTML navigations receive the entry file in SPA mode,
+// while assets and API paths keep returning 404.
+func TestSPAFallback(t *testing.T) {
+	tmpDir := t.TempDir()
+	htmlPath := filepath.Join(tmpDir, "index.html")
+	os.WriteFile(htmlPath, []byte(`<html><body>Entry</body></html>`), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "app.js"), []byte("console.log('hi')"), 0644)
+
+	ts := httptest.NewServer(DevServer(htmlPath, Config{SPA: true}))
+	defer ts.Close()
+
+	get := func(path string, accept string) (int, string) {
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get("/settings/profile", "text/html,application/xhtml+xml")
+	if status != http.StatusOK || !strings.Contains(body, "Entry") || !strings.Contains(body, "WebSocket") {
+		t.Fatalf("Expected injected entry file for deep link, got %d: %s", status, body)
+	}
+	if status, _ := get("/app.js", "*/*"); status != http.StatusOK {
+		t.Fatalf("Expected 200 OK for existing asset, got %d", status)
+	}
+	if status, _ := get("/missing.js", "text/html"); status != http.StatusNotFound {
+		t.Fatalf("Expected 404 for missing asset, got %d", status)
+	}
+	if status, _ := get("/api/users", "text/html"); status != http.StatusNotFound {
+		t.Fatalf("Expected 404 for API path, got %d", status)
+	}
+	if status, _ := get("/settings/profile", "application/json"); status != http.StatusNotFound {
+		t.Fatalf("Expected 404 for non-HTML request, got %d", status)
+	}
+}
+
+// TestMounts verifies that mounted directories are served under their prefix and that
+// linked files under a mount trigger reloads.
+func TestMounts(t *testing.T) {
+	appDir := t.TempDir()
+	uiDir := t.TempDir()
+	htmlPath := filepath.Join(appDir, "index.html")
+	cssPath := filepath.Join(uiDir, "ui.css")
+	os.WriteFile(htmlPath, []byte(`<html><head><link rel="stylesheet" href="/ui/ui.css"></head><body>Hello</body></html>`), 0644)
+	os.WriteFile(cssPath, []byte("body{}"), 0644)
+
+	config := Config{Mounts: []Mount{{Prefix: "/ui", Dir: uiDir}}}
+	if files := buildDependencyGraph(htmlPath, config).Files(); !slices.Contains(files, cssPath) {
+		t.Fatalf("Expected mounted asset %s, got %v", cssPath, files)
+	}
+
+	go StartFileWatcher(context.Background(), htmlPath, config)
+	ts := httptest.NewServer(DevServer(htmlPath, config))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/ui/ui.css")
+	if err != nil {
+		t.Fatalf("GET /ui/ui.css failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "body{}" {
+		t.Fatalf("Expected mounted CSS, got %d: %q", resp.StatusCode, body)
+	}
+
+	u, _ := url.Parse(ts.URL)
+	wsConn := dialWebSocket(t, u.Host)
+	defer wsConn.Close()
+
+	os.WriteFile(cssPath, []byte("body{color:red}"), 0644)
+	newTime := time.Now().Add(2 * time.Second)
+	os.Chtimes(cssPath, newTime, newTime)
+
+	done := make(chan string, 1)
+	go func() { done <- readWebSocketMessage(t, wsConn) }()
+
+	select {
+	case msg := <-done:
+		if msg != "reload" {
+			t.Fatalf("Expected 'reload' message, got: %q", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for reload message")
+	}
+}
+
 func getHtmlContent(t *testing.T, url string) string {
 	resp, err := http.Get(url)
 	if err != nil {
@@ -256,3 +387,33 @@ func readWebSocketMessage(t *testing.T, conn net.Conn) string {
 
 	return string(payload)
 }
+
+// TestWatchServedPages verifies that the watcher adds the dependencies of
+// every served page, however many are served at once.
+func TestWatchServedPages(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"index.html": "<html></html>"}
+	for i := 0; i < 40; i++ {
+		files[fmt.Sprintf("page%d.md", i)] = fmt.Sprintf("![](img%d.png)", i)
+		files[fmt.Sprintf("img%d.png", i)] = "png"
+	}
+	writeFiles(t, dir, files)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go StartFileWatcher(ctx, filepath.Join(dir, "index.html"), Config{})
+	for i := 0; i < 40; i++ {
+		watchPage(filepath.Join(dir, fmt.Sprintf("page%d.md", i)))
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for i := 0; i < 40; i++ {
+		image := filepath.Join(dir, fmt.Sprintf("img%d.png", i))
+		for !slices.ContainsFunc(watchedFiles.List(), func(f WatchedFile) bool { return f.Path == image }) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %s to be watched", image)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
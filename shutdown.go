@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// shutdownTimeout is how long in-flight requests may take to finish on shutdown.
+	shutdownTimeout = 5 * time.Second
+	// wsCloseTimeout is how long WebSocket clients have to answer the close frame.
+	wsCloseTimeout = time.Second
+
+	wsCloseNormal        = 1000
+	wsCloseGoingAway     = 1001
+	wsCloseReasonStopped = "server shutting down"
+)
+
+// serverContext is canceled when dotdev is asked to stop, by a signal or by
+// the q key. Cancelling it with stopServer shuts the server down gracefully.
+var serverContext, stopServer = context.WithCancel(context.Background())
+
+// shutdownServer closes the WebSocket clients with a close frame and waits for
+// in-flight requests to finish.
+func shutdownServer(server *http.Server) {
+	ServerState.RecordEvent("shutdown", "Shutting down")
+	closeWebSockets(wsCloseGoingAway, wsCloseReasonStopped)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down the server: %v\n", err)
+	}
+}
+
+// closeWebSockets sends a close frame to all connected WebSocket clients and
+// waits for them to disconnect. Clients that do not answer in time are closed.
+func closeWebSockets(code int, reason string) {
+	wsMutex.Lock()
+	for _, c := range wsClients {
+		c.closing = true
+		if err := sendClose(c.conn, code, reason); err != nil {
+			c.conn.Close()
+		}
+	}
+	wsMutex.Unlock()
+
+	deadline := time.Now().Add(wsCloseTimeout)
+	for time.Now().Before(deadline) {
+		wsMutex.Lock()
+		remaining := len(wsClients)
+		wsMutex.Unlock()
+		if remaining == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	wsMutex.Lock()
+	defer wsMutex.Unlock()
+	for _, c := range wsClients {
+		c.conn.Close()
+	}
+}
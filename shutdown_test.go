@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCloseWebSockets verifies that clients receive a close frame with the
+// shutdown reason and are removed once they answer it.
+func TestCloseWebSockets(t *testing.T) {
+	tmpDir := t.TempDir()
+	htmlPath := filepath.Join(tmpDir, "index.html")
+	os.WriteFile(htmlPath, []byte(`<html><body>Hello</body></html>`), 0644)
+
+	ts := httptest.NewServer(DevServer(htmlPath, Config{}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	conn := dialWebSocketPath(t, u.Host, "/ws?page=/")
+	defer conn.Close()
+	waitForClients(t, 1)
+
+	done := make(chan struct{})
+	go func() {
+		closeWebSockets(wsCloseGoingAway, wsCloseReasonStopped)
+		close(done)
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	header := make([]byte, 2)
+	if _, err := conn.Read(header); err != nil {
+		t.Fatalf("Failed to read close frame: %v", err)
+	}
+	if header[0] != 0x88 {
+		t.Fatalf("Expected a close frame, got opcode %#x", header[0])
+	}
+	payload := make([]byte, header[1])
+	if _, err := conn.Read(payload); err != nil {
+		t.Fatalf("Failed to read close payload: %v", err)
+	}
+	if code := binary.BigEndian.Uint16(payload); code != wsCloseGoingAway {
+		t.Fatalf("Expected close code %d, got %d", wsCloseGoingAway, code)
+	}
+	if reason := string(payload[2:]); reason != wsCloseReasonStopped {
+		t.Fatalf("Expected close reason %q, got %q", wsCloseReasonStopped, reason)
+	}
+
+	// Answer with a masked close frame, as a browser would.
+	conn.Write([]byte{0x88, 0x80, 0, 0, 0, 0})
+	select {
+	case <-done:
+	case <-time.After(wsCloseTimeout / 2):
+		t.Fatalf("Expected closeWebSockets to return once the client answered")
+	}
+	waitForClients(t, 0)
+}
+
+// TestReadFrame verifies that client frames are read by their headers, so a
+// payload byte is never mistaken for an opcode.
+func TestReadFrame(t *testing.T) {
+	long := append([]byte{0x81, 0x80 | 126, 0, 200, 1, 2, 3, 4}, make([]byte, 200)...)
+	// A payload starting like a close frame header.
+	long[8] = 0x88
+	tests := []struct {
+		frames  []byte
+		opcodes []byte
+	}{
+		{[]byte{0x88, 0x80, 0, 0, 0, 0}, []byte{wsOpcodeClose}},
+		{[]byte{0x89, 0x82, 1, 2, 3, 4, 0x88, 0x88, 0x8A, 0x00}, []byte{0x9, 0xA}},
+		{append(long, 0x88, 0x82, 0, 0, 0, 0, 0x03, 0xE8), []byte{0x1, wsOpcodeClose}},
+		{append([]byte{0x82, 0x80 | 127, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 'h', 'i'}, 0x88, 0x00), []byte{0x2, wsOpcodeClose}},
+	}
+	for _, test := range tests {
+		r := bufio.NewReader(bytes.NewReader(test.frames))
+		for _, expected := range test.opcodes {
+			if opcode, err := readFrame(r); err != nil || opcode != expected {
+				t.Fatalf("Expected opcode %#x from %v, got %#x, %v", expected, test.frames, opcode, err)
+			}
+		}
+		if _, err := readFrame(r); err != io.EOF {
+			t.Fatalf("Expected the frames %v to be consumed, got %v", test.frames, err)
+		}
+	}
+	if _, err := readFrame(bufio.NewReader(bytes.NewReader([]byte{0x81, 0x85, 1, 2}))); err == nil {
+		t.Fatalf("Expected a truncated frame to fail, got %v", err)
+	}
+}
+
+// TestClientClose verifies that the server answers a close frame initiated by
+// the client and forgets it.
+func TestClientClose(t *testing.T) {
+	tmpDir := t.TempDir()
+	htmlPath := filepath.Join(tmpDir, "index.html")
+	os.WriteFile(htmlPath, []byte(`<html><body>Hello</body></html>`), 0644)
+
+	ts := httptest.NewServer(DevServer(htmlPath, Config{}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	conn := dialWebSocketPath(t, u.Host, "/ws?page=/")
+	defer conn.Close()
+	waitForClients(t, 1)
+
+	conn.Write([]byte{0x88, 0x82, 0, 0, 0, 0, 0x03, 0xE8})
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatalf("Failed to read close frame: %v", err)
+	}
+	if header[0] != 0x88 || binary.BigEndian.Uint16(header[2:]) != wsCloseNormal {
+		t.Fatalf("Expected a normal close frame, got %v", header)
+	}
+	waitForClients(t, 0)
+}
+
+// TestStartDevServerShutdown verifies that the server returns when its context
+// is canceled.
+func TestStartDevServerShutdown(t *testing.T) {
+	tmpDir := t.TempDir()
+	htmlPath := filepath.Join(tmpDir, "index.html")
+	os.WriteFile(htmlPath, []byte(`<html><body>Hello</body></html>`), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		StartDevServer(ctx, htmlPath, Config{Host: "127.0.0.1", Port: 0}, nil)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		t.Fatalf("Expected StartDevServer to return after the context was canceled")
+	}
+}
+
+// waitForClients waits until the number of connected WebSocket clients is n.
+func waitForClients(t *testing.T, n int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		wsMutex.Lock()
+		count := len(wsClients)
+		wsMutex.Unlock()
+		if count == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d connected clients", n)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// spaExcludedPrefixes are URL prefixes that never fall back to the entry file,
+// so API calls and dotdev endpoints keep returning real 404s.
+var spaExcludedPrefixes = []string{"/api/", "/ws", internalPathPrefix}
+
+// isSPARoute reports whether the request is a client-side route that should be
+// answered with the entry file: a GET or HEAD navigation accepting HTML for a
+// path without a file extension.
+func isSPARoute(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return false
+	}
+	for _, prefix := range spaExcludedPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	}
+	return path.Ext(r.URL.Path) == ""
+}
+
+// fileExists reports whether a file or directory exists at the given path.
+func fileExists(filePath string) bool {
+	_, err := os.Stat(filePath)
+	return err == nil
+}
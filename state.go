@@ -1,11 +1,13 @@
 package main
 
 import (
-	"fmt"
-	"os"
+	"log/slog"
+	"sync"
 	"time"
 )
 
+// State is a snapshot of the dev server state. Snapshots are values handed out
+// by StateStore and are never modified after they are taken.
 type State struct {
 	ConnectedClients int
 	StartedAt        time.Time
@@ -16,60 +18,214 @@ type State struct {
 	ServePath        string
 	Status           string
 	Urls             []string
+	// LANURL is the URL other devices on the network open, if any.
+	LANURL string
+	// Paused is set while reloads triggered by file changes are suspended.
+	Paused bool
+	// TotalRequests, TotalErrors and TotalUpdates are the counters since the
+	// start, for the status and metrics endpoints. Unlike NoRequests, NoErrors
+	// and NoUpdates, the c key does not clear them.
+	TotalRequests int
+	TotalErrors   int
+	TotalUpdates  int
+	// Events holds the most recent events, oldest first.
+	Events []Event
 }
 
-var ServerState = State{
-	ConnectedClients: 0,
-	StartedAt:        time.Now(),
-	NoRequests:       0,
-	NoErrors:         0,
-	ServeFsDir:       "",
-	ServePath:        "",
-	Urls:             []string{},
+// Event is a notable occurrence in the dev server, such as a file change or a
+// client connecting. Seq increases with every recorded event.
+type Event struct {
+	Seq     int
+	Time    time.Time
+	Kind    string
+	Message string
+	// Attrs holds structured details of the event, such as the request path.
+	Attrs []slog.Attr
 }
 
-var stateUpdateCh = make(chan struct{}, 1)
+// maxEvents is the number of recent events kept in the state.
+const maxEvents = 200
 
-// notifyStateUpdate is called when ServerState is modified.
-func unthrottledNotifyServerStateUpdate() {
-	// Non-blocking send: if the channel already has a signal, we don't block.
-	select {
-	case stateUpdateCh <- struct{}{}:
-	default:
+// clone returns a deep copy of the state, so it can be handed to readers.
+func (s State) clone() State {
+	s.Urls = append([]string(nil), s.Urls...)
+	s.Events = append([]Event(nil), s.Events...)
+	return s
+}
+
+// StateStore guards the server state shared by HTTP handlers, WebSocket
+// connections and file watchers. All changes go through Update, and readers
+// either take a Snapshot or Subscribe to changes.
+type StateStore struct {
+	mu          sync.Mutex
+	state       State
+	eventSeq    int
+	subscribers map[chan State]struct{}
+	notify      func()
+	closed      bool
+	// eventLog receives every recorded event, in order. logMu keeps events
+	// from being logged out of order.
+	eventLog func(Event)
+	logMu    sync.Mutex
+}
+
+func NewStateStore() *StateStore {
+	s := &StateStore{
+		state: State{
+			StartedAt: time.Now(),
+			Urls:      []string{},
+		},
+		subscribers: map[chan State]struct{}{},
 	}
+	s.notify = Throttle(s.publish, 100*time.Millisecond)
+	return s
 }
 
-var notifyServerStateUpdate = Throttle(unthrottledNotifyServerStateUpdate, 100*time.Millisecond)
+var ServerState = NewStateStore()
 
-func monitorServerState() {
-	renders := 0
-	for {
-		<-stateUpdateCh
+// Update applies fn to the state under the store lock and notifies subscribers.
+func (s *StateStore) Update(fn func(state *State)) {
+	s.mu.Lock()
+	fn(&s.state)
+	s.mu.Unlock()
+	s.notify()
+}
+
+// Snapshot returns a copy of the current state.
+func (s *StateStore) Snapshot() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.clone()
+}
+
+// Subscribe returns a channel receiving a snapshot of the state after changes,
+// starting with the current one, and a function ending the subscription.
+// Changes are throttled, and a slow subscriber only receives the latest snapshot.
+func (s *StateStore) Subscribe() (<-chan State, func()) {
+	ch := make(chan State, 1)
+	s.mu.Lock()
+	ch <- s.state.clone()
+	if s.closed {
+		close(ch)
+	} else {
+		s.subscribers[ch] = struct{}{}
+	}
+	s.mu.Unlock()
 
-		// Drain any additional pending updates.
-		for len(stateUpdateCh) > 0 {
-			<-stateUpdateCh
+	unsubscribe := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
 		}
+	}
+	return ch, unsubscribe
+}
+
+// publish sends the current snapshot to all subscribers, replacing any snapshot
+// they have not received yet.
+func (s *StateStore) publish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	snapshot := s.state.clone()
+	for ch := range s.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- snapshot
+	}
+}
+
+// Close sends the current snapshot to all subscribers right away and then
+// closes their channels, so they can report the final state before exiting.
+func (s *StateStore) Close() {
+	s.publish()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for ch := range s.subscribers {
+		delete(s.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (s *StateStore) IncRequests() {
+	s.Update(func(state *State) {
+		state.NoRequests++
+		state.TotalRequests++
+	})
+}
+
+func (s *StateStore) IncErrors() {
+	s.Update(func(state *State) {
+		state.NoErrors++
+		state.TotalErrors++
+	})
+}
+
+func (s *StateStore) IncUpdates() {
+	s.Update(func(state *State) {
+		state.NoUpdates++
+		state.TotalUpdates++
+	})
+}
+
+func (s *StateStore) SetConnectedClients(n int) {
+	s.Update(func(state *State) { state.ConnectedClients = n })
+}
+
+// ResetCounters sets the request, update and error counters shown in the
+// terminal back to zero. The totals are kept.
+func (s *StateStore) ResetCounters() {
+	s.Update(func(state *State) {
+		state.NoRequests = 0
+		state.NoUpdates = 0
+		state.NoErrors = 0
+	})
+}
+
+// IsPaused reports whether reloads are paused.
+func (s *StateStore) IsPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.Paused
+}
+
+// SetEventLog sets a function receiving every event as it is recorded.
+// Unlike subscribers, which only see the latest snapshot and its last
+// maxEvents events, it never misses one.
+func (s *StateStore) SetEventLog(fn func(Event)) {
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	s.eventLog = fn
+}
 
-		if renders > 0 {
-			fmt.Fprintf(os.Stderr, "\033[6A")
+// RecordEvent appends an event to the state, dropping the oldest one when
+// more than maxEvents are kept, and passes it to the event log.
+func (s *StateStore) RecordEvent(kind string, message string, attrs ...slog.Attr) {
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	var event Event
+	s.Update(func(state *State) {
+		s.eventSeq++
+		event = Event{
+			Seq:     s.eventSeq,
+			Time:    time.Now(),
+			Kind:    kind,
+			Message: message,
+			Attrs:   attrs,
 		}
-		renders += 1
-		var url string
-		if len(ServerState.Urls) > 0 {
-			url = ServerState.Urls[0]
-		} else {
-			url = "<empty>"
+		state.Events = append(state.Events, event)
+		if len(state.Events) > maxEvents {
+			state.Events = append([]Event(nil), state.Events[len(state.Events)-maxEvents:]...)
 		}
-		fmt.Fprintf(os.Stderr, "\r\033[K%s%s%s%s serving %s%s%s from %s%s%s on\n",
-			Clr.Bold, Clr.Green, "dotdev", Clr.Reset,
-			Clr.Bold, ServerState.ServePath, Clr.Reset,
-			Clr.Bold, ServerState.ServeFsDir, Clr.Reset,
-		)
-		fmt.Fprintf(os.Stderr, "\n")
-		fmt.Fprintf(os.Stderr, "\r\033[K    %s%s%s\n", Clr.Bold, url, Clr.Reset)
-		fmt.Fprintf(os.Stderr, "\n")
-		fmt.Fprintf(os.Stderr, "\r\033[KRequests: %d, Updates: %d, Errors: %d, WS clients: %d\n", ServerState.NoRequests, ServerState.NoUpdates, ServerState.NoErrors, ServerState.ConnectedClients)
-		fmt.Fprintf(os.Stderr, "\r\033[K%sRuntime: %s, Renders: %d%s\n", Clr.Neutral, time.Since(ServerState.StartedAt).Round(time.Second), renders, Clr.Reset)
+	})
+	if s.eventLog != nil {
+		s.eventLog(event)
 	}
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStateStoreConcurrentUpdates verifies that concurrent updates are not lost.
+func TestStateStoreConcurrentUpdates(t *testing.T) {
+	store := NewStateStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				store.IncRequests()
+				store.IncUpdates()
+				_ = store.Snapshot()
+			}
+		}()
+	}
+	wg.Wait()
+
+	state := store.Snapshot()
+	if state.NoRequests != 1000 || state.NoUpdates != 1000 {
+		t.Fatalf("Expected 1000 requests and updates, got %d and %d", state.NoRequests, state.NoUpdates)
+	}
+}
+
+// TestStateStoreSubscribe verifies that subscribers receive the current state and later changes,
+// and that snapshots are not affected by later updates.
+func TestStateStoreSubscribe(t *testing.T) {
+	store := NewStateStore()
+	store.Update(func(state *State) { state.Urls = []string{"http://127.0.0.1:4774"} })
+
+	updates, unsubscribe := store.Subscribe()
+	defer unsubscribe()
+
+	initial := <-updates
+	if len(initial.Urls) != 1 {
+		t.Fatalf("Expected initial snapshot with URL, got %+v", initial)
+	}
+
+	store.Update(func(state *State) { state.Urls[0] = "http://localhost:4774" })
+	store.IncErrors()
+	if initial.Urls[0] != "http://127.0.0.1:4774" {
+		t.Fatalf("Expected snapshot to be immutable, got %s", initial.Urls[0])
+	}
+
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case state := <-updates:
+			if state.NoErrors == 1 && state.Urls[0] == "http://localhost:4774" {
+				return
+			}
+		case <-deadline:
+			t.Fatal("Timed out waiting for state update")
+		}
+	}
+}
+
+// TestStateStoreClose verifies that closing the store delivers pending changes
+// without waiting for the throttle and closes the subscriptions.
+func TestStateStoreClose(t *testing.T) {
+	store := NewStateStore()
+	updates, unsubscribe := store.Subscribe()
+	defer unsubscribe()
+	<-updates
+
+	store.RecordEvent("shutdown", "Shutting down")
+	store.Close()
+
+	state, ok := <-updates
+	if !ok || len(state.Events) != 1 || state.Events[0].Kind != "shutdown" {
+		t.Fatalf("Expected final snapshot with the shutdown event, got %+v", state)
+	}
+	if _, ok := <-updates; ok {
+		t.Fatalf("Expected subscription to be closed")
+	}
+	store.IncRequests()
+	time.Sleep(150 * time.Millisecond)
+}
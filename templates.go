@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// templatesDir holds the layouts and partials of pages rendered with
+	// --template, named by their path in it.
+	templatesDir = "_templates"
+	// templateDataDir holds the JSON files passed to templates, keyed by
+	// their name without the extension.
+	templateDataDir = "data"
+)
+
+// isTemplateFile reports whether a file in the templates directory is a
+// template.
+func isTemplateFile(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	return ext == ".html" || ext == ".htm" || ext == ".tmpl"
+}
+
+// templateFiles returns the templates and data files available to the pages
+// served from the root, which a page rendered with --template depends on.
+func templateFiles(root string) []string {
+	data, _ := filepath.Glob(filepath.Join(root, templateDataDir, "*.json"))
+	return append(templatePartials(root), data...)
+}
+
+// templatePartials returns the templates of the _templates directory.
+func templatePartials(root string) []string {
+	var files []string
+	filepath.WalkDir(filepath.Join(root, templatesDir), func(file string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && isTemplateFile(file) {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files
+}
+
+// renderTemplate executes a page served from the root as an html/template.
+// The templates of the _templates directory are parsed first, so the page can
+// use them as layouts and partials with {{template}}, and fill their
+// {{block}}s with {{define}}. The data files of the data directory are the
+// data of the page, e.g. data/products.json is {{.products}}.
+func renderTemplate(content []byte, file string, root string) ([]byte, error) {
+	data, err := loadTemplateData(root)
+	if err != nil {
+		return nil, err
+	}
+
+	name := displayPath(root, file)
+	tmpl := template.New(name)
+	dir := filepath.Join(root, templatesDir)
+	for _, partial := range templatePartials(root) {
+		text, err := os.ReadFile(partial)
+		if err != nil {
+			return nil, err
+		}
+		rel, _ := filepath.Rel(dir, partial)
+		if _, err := tmpl.New(filepath.ToSlash(rel)).Parse(string(text)); err != nil {
+			return nil, err
+		}
+	}
+	// The page is parsed last, so its definitions replace the blocks of the
+	// layouts.
+	if _, err := tmpl.Parse(string(content)); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// processPage returns an HTML page served from the root as dotdev serves it,
+// with its includes expanded and, with template, rendered as a template.
+func processPage(content []byte, file string, root string, mounts []Mount, template bool) ([]byte, error) {
+	content, _, err := expandIncludes(content, file, root, mounts)
+	if err == nil && template && !isMarkdownFile(file) {
+		content, err = renderTemplate(content, file, root)
+	}
+	return content, err
+}
+
+// watchTemplateFiles calls onChange when templates or data files are added
+// or removed, until the context is canceled. Changes of the existing files
+// are noticed by their own watches.
+func watchTemplateFiles(ctx context.Context, root string, onChange func()) {
+	defer restoreTerminalOnPanic()
+	last := strings.Join(templateFiles(root), "\n")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+		if files := strings.Join(templateFiles(root), "\n"); files != last {
+			last = files
+			onChange()
+		}
+	}
+}
+
+// loadTemplateData reads the JSON files of the data directory of the root,
+// keyed by their name without the extension.
+func loadTemplateData(root string) (map[string]any, error) {
+	files, _ := filepath.Glob(filepath.Join(root, templateDataDir, "*.json"))
+	sort.Strings(files)
+	data := map[string]any{}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var value any
+		if err := json.Unmarshal(content, &value); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return nil, fmt.Errorf("%s line %d: %v", displayPath(root, file), lineAt(content, syntaxErr.Offset), err)
+			}
+			return nil, fmt.Errorf("%s: %v", displayPath(root, file), err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		data[name] = value
+	}
+	return data, nil
+}
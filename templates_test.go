@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"_templates/layout.html":          `<title>{{block "title" .}}Shop{{end}}</title><main>{{block "content" .}}{{end}}</main>{{template "partials/footer.html" .}}`,
+		"_templates/partials/footer.html": `<footer>{{.site.name}}</footer>`,
+		"data/site.json":                  `{"name": "Acme & Co"}`,
+		"data/products.json":              `[{"name": "Anvil", "price": 10}, {"name": "<Rocket>", "price": 99}]`,
+		"notes.txt":                       "",
+	})
+	page := filepath.Join(dir, "index.html")
+
+	content := `{{define "content"}}{{range .products}}<li>{{.name}}: {{.price}}</li>{{end}}{{end}}{{template "layout.html" .}}`
+	rendered, err := renderTemplate([]byte(content), page, dir)
+	if err != nil {
+		t.Fatalf("Expected the template to render, got %v", err)
+	}
+	expected := `<title>Shop</title><main><li>Anvil: 10</li><li>&lt;Rocket&gt;: 99</li></main><footer>Acme &amp; Co</footer>`
+	if string(rendered) != expected {
+		t.Fatalf("Expected %s, got %s", expected, rendered)
+	}
+
+	errors := map[string]string{
+		"<p>\n{{.site.name}\n</p>":             "template: index.html:2: bad character U+007D '}'",
+		"<p>\n\n{{template \"missing.html\"}}": `html/template:index.html:3:11: no such template "missing.html"`,
+	}
+	for content, expected := range errors {
+		if _, err := renderTemplate([]byte(content), page, dir); err == nil || err.Error() != expected {
+			t.Fatalf("Expected error %q, got %v", expected, err)
+		}
+	}
+
+	writeFiles(t, dir, map[string]string{"data/site.json": "{\n  \"name\": \"Acme\",\n}"})
+	_, err = renderTemplate([]byte("{{.site.name}}"), page, dir)
+	if err == nil || !strings.HasPrefix(err.Error(), "data/site.json line 3: ") {
+		t.Fatalf("Expected the invalid data file and line in the error, got %v", err)
+	}
+}
+
+func TestServeTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"index.html":             `{{define "content"}}<h1>{{.site.name}}</h1>{{end}}{{template "layout.html" .}}`,
+		"about.html":             `<p>{{len .site.name}}</p>`,
+		"broken.html":            `<p>{{.site.name.first}}</p>`,
+		"_templates/layout.html": `<html><head><link rel="stylesheet" href="/style.css"></head><body>{{block "content" .}}{{end}}</body></html>`,
+		"data/site.json":         `{"name": "Acme"}`,
+		"style.css":              "",
+	})
+	entry := filepath.Join(dir, "index.html")
+	config := Config{Template: true}
+
+	ts := httptest.NewServer(DevServer(entry, config))
+	defer ts.Close()
+	get := func(path string) (int, string) {
+		resp, err := ts.Client().Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := get("/"); status != 200 || !strings.Contains(body, "<h1>Acme</h1>") || !strings.Contains(body, "new WebSocket") {
+		t.Fatalf("Expected the page to be rendered with the layout and data, got %d %s", status, body)
+	}
+	if _, body := get("/about.html"); !strings.Contains(body, "<p>4</p>") {
+		t.Fatalf("Expected other pages to be rendered too, got %s", body)
+	}
+	status, body := get("/broken.html")
+	if status != 500 || !strings.Contains(body, "template: broken.html:1:10: executing &#34;broken.html&#34; at &lt;.site.name.first&gt;") {
+		t.Fatalf("Expected an error page with the file and line, got %d %s", status, body)
+	}
+
+	files := strings.Join(buildDependencyGraph(entry, config).Files(), "\n")
+	for _, expected := range []string{filepath.Join("_templates", "layout.html"), filepath.Join("data", "site.json"), "style.css"} {
+		if !strings.Contains(files, expected) {
+			t.Fatalf("Expected %s to be watched, got %s", expected, files)
+		}
+	}
+}
+
+func TestCheckTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"index.html":            `{{template "nav.html" .}}<img src="{{.site.logo}}">`,
+		"_templates/nav.html":   `<nav><a href="{{.site.home}}">Home</a></nav>`,
+		"data/site.json":        `{"home": "/index.html", "logo": "/img/logo.png"}`,
+		"partials/footer.html":  "",
+		"included.html":         `<!--#include file="partials/footer.html" --><a href="/index.html">Home</a>`,
+		"included-missing.html": `<!--#include file="partials/none.html" -->`,
+	})
+	index := filepath.Join(dir, "index.html")
+
+	checker := newReferenceChecker(dir, nil, false)
+	checker.template = true
+	broken, checked, err := checker.checkFile(index)
+	if err != nil || checked != 2 || len(broken) != 1 || broken[0].URL != "/img/logo.png" || broken[0].Problem != "not found" {
+		t.Fatalf("Expected the rendered page to be checked, got %v, %d, %v", broken, checked, err)
+	}
+
+	broken, _, _ = newReferenceChecker(dir, nil, false).checkFile(index)
+	if len(broken) != 1 || broken[0].URL != "{{.site.logo}}" {
+		t.Fatalf("Expected the page to be checked as is without --template, got %v", broken)
+	}
+
+	if broken, checked, err := newReferenceChecker(dir, nil, false).checkFile(filepath.Join(dir, "included.html")); err != nil || checked != 1 || len(broken) != 0 {
+		t.Fatalf("Expected the page with its includes to be checked, got %v, %d, %v", broken, checked, err)
+	}
+	if _, _, err := newReferenceChecker(dir, nil, false).checkFile(filepath.Join(dir, "included-missing.html")); err == nil || !strings.Contains(err.Error(), "the partial partials/none.html does not exist") {
+		t.Fatalf("Expected an error for a missing partial, got %v", err)
+	}
+}
+
+func TestWatchTemplateFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"index.html":     `<p>{{.site.name}}</p>`,
+		"data/site.json": `{"name": "Acme"}`,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go StartFileWatcher(ctx, filepath.Join(dir, "index.html"), Config{Template: true})
+
+	changes, unsubscribe := watchedFiles.Subscribe()
+	defer unsubscribe()
+	time.Sleep(100 * time.Millisecond)
+	writeFiles(t, dir, map[string]string{"_templates/nested/nav.html": "<nav></nav>"})
+	select {
+	case <-changes:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Expected adding a template to be reported as a change")
+	}
+	added := filepath.Join(dir, "_templates", "nested", "nav.html")
+	deadline := time.Now().Add(2 * time.Second)
+	for !slices.ContainsFunc(watchedFiles.List(), func(f WatchedFile) bool { return f.Path == added }) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the added template %s to be watched", added)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// makeRaw is a stub for non-Linux platforms.
+func makeRaw(_ int) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
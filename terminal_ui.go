@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// terminalUI renders the server state to the terminal, redrawing the status
+// block in place. It is owned by the monitorServerState goroutine.
+type terminalUI struct {
+	// out receives the rendered output, os.Stderr when nil.
+	out      io.Writer
+	state    State
+	renders  int
+	lines    int
+	controls bool
+	showLog  bool
+	showHelp bool
+	// lastEvent is the sequence number of the last event handled by the log.
+	lastEvent int
+	// qrShown is set once the QR code of the LAN URL was printed.
+	qrShown bool
+}
+
+// terminalActions are applied to the terminal UI by the monitor goroutine,
+// followed by a redraw.
+var terminalActions = make(chan func(ui *terminalUI), 8)
+
+// terminalMonitorDone is closed when the monitor applying terminalActions
+// exits, so key presses no longer wait for it.
+var (
+	terminalMonitorMu   sync.Mutex
+	terminalMonitorDone chan struct{}
+)
+
+// sendTerminalAction passes an action to the monitor. It waits while the
+// monitor runs, and only drops the action once it has exited, or when no
+// monitor started and the queue is full.
+func sendTerminalAction(action func(ui *terminalUI)) {
+	terminalMonitorMu.Lock()
+	done := terminalMonitorDone
+	terminalMonitorMu.Unlock()
+	if done == nil {
+		select {
+		case terminalActions <- action:
+		default:
+		}
+		return
+	}
+	select {
+	case terminalActions <- action:
+	case <-done:
+	}
+}
+
+// monitorPretty draws the status block on a terminal and keeps it up to date.
+// The event log starts out visible in verbose mode.
+func monitorPretty(showLog bool) {
+	done := make(chan struct{})
+	terminalMonitorMu.Lock()
+	terminalMonitorDone = done
+	terminalMonitorMu.Unlock()
+	defer close(done)
+
+	updates, _ := ServerState.Subscribe()
+	ui := &terminalUI{showLog: showLog}
+	for {
+		select {
+		case state, ok := <-updates:
+			if !ok {
+				return
+			}
+			ui.state = state
+		case action := <-terminalActions:
+			action(ui)
+		}
+		ui.render()
+	}
+}
+
+func (ui *terminalUI) render() {
+	var b strings.Builder
+	if ui.lines > 0 {
+		// Move to the start of the previous status block and clear it.
+		fmt.Fprintf(&b, "\033[%dA\r\033[J", ui.lines)
+	}
+	for _, e := range ui.state.Events {
+		if e.Seq <= ui.lastEvent {
+			continue
+		}
+		ui.lastEvent = e.Seq
+		if e.Kind == "serving" {
+			// The status block shows the URLs.
+			continue
+		}
+		// Failed requests and broken references are shown even with the log
+		// hidden, so missing assets stand out.
+		color, highlight := "", true
+		if status := eventStatus(e); status >= 500 {
+			color = Clr.Red
+		} else if status >= 400 || e.Kind == "warning" {
+			color = Clr.Yellow
+		} else {
+			highlight = false
+		}
+		if ui.showLog || highlight {
+			fmt.Fprintf(&b, "%s%s%s %-10s %s%s%s\n", Clr.Neutral, e.Time.Format("15:04:05"), Clr.Reset, e.Kind, color, e.Message, Clr.Reset)
+		}
+	}
+
+	state := ui.state
+	if state.LANURL != "" && !ui.qrShown {
+		// The QR code is printed once above the status, so phones can open the page.
+		if qr, err := encodeQR(state.LANURL); err == nil {
+			fmt.Fprintf(&b, "%sScan to open %s%s\n%s", Clr.Neutral, state.LANURL, Clr.Reset, qr)
+		}
+		ui.qrShown = true
+	}
+
+	ui.renders += 1
+	urls := state.Urls
+	if len(urls) == 0 {
+		urls = []string{"<empty>"}
+	}
+	block := []string{
+		fmt.Sprintf("%s%s%s%s serving %s%s%s from %s%s%s on",
+			Clr.Bold, Clr.Green, "dotdev", Clr.Reset,
+			Clr.Bold, state.ServePath, Clr.Reset,
+			Clr.Bold, state.ServeFsDir, Clr.Reset,
+		),
+		"",
+	}
+	for _, url := range urls {
+		block = append(block, fmt.Sprintf("    %s%s%s", Clr.Bold, url, Clr.Reset))
+	}
+	block = append(block,
+		"",
+		fmt.Sprintf("Requests: %d, Updates: %d, Errors: %d, WS clients: %d", state.NoRequests, state.NoUpdates, state.NoErrors, state.ConnectedClients),
+		fmt.Sprintf("%sRuntime: %s, Renders: %d%s", Clr.Neutral, time.Since(state.StartedAt).Round(time.Second), ui.renders, Clr.Reset),
+	)
+	if state.Paused {
+		block = append(block, fmt.Sprintf("%sReloads paused, press p to resume%s", Clr.Yellow, Clr.Reset))
+	}
+	if ui.showHelp {
+		block = append(block,
+			"",
+			fmt.Sprintf("%sKEYS:%s", Clr.Bold, Clr.Reset),
+			"    r  Reload connected browsers",
+			"    p  Pause or resume reloads on file changes",
+			"    c  Clear the counters",
+			"    l  Toggle the event log",
+			"    q  Quit",
+			"    ?  Toggle this help",
+		)
+	} else if ui.controls {
+		block = append(block, fmt.Sprintf("%sPress ? for help%s", Clr.Neutral, Clr.Reset))
+	}
+	for _, line := range block {
+		fmt.Fprintf(&b, "\r\033[K%s\n", line)
+	}
+	ui.lines = len(block)
+	out := ui.out
+	if out == nil {
+		out = os.Stderr
+	}
+	io.WriteString(out, b.String())
+}
+
+var (
+	restoreTerminalMu sync.Mutex
+	restoreTerminalFn func()
+)
+
+// restoreTerminal puts the terminal back into the mode it had before the
+// interactive controls were started. It is safe to call more than once.
+func restoreTerminal() {
+	restoreTerminalMu.Lock()
+	defer restoreTerminalMu.Unlock()
+	if restoreTerminalFn != nil {
+		restoreTerminalFn()
+		restoreTerminalFn = nil
+	}
+}
+
+// restoreTerminalOnPanic restores the terminal when the goroutine it is
+// deferred in panics, then lets the panic continue. A panic in any goroutine
+// ends the process without running the deferred calls of the others, so
+// every long-running goroutine defers it.
+func restoreTerminalOnPanic() {
+	if r := recover(); r != nil {
+		restoreTerminal()
+		panic(r)
+	}
+}
+
+// exitGracefully restores the terminal and exits the process.
+func exitGracefully(code int) {
+	restoreTerminal()
+	os.Exit(code)
+}
+
+// isTerminal reports whether the file is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// startTerminalControls reads single key presses from stdin and runs the
+// matching action. It does nothing when stdin is not a terminal or the
+// terminal cannot be put into raw mode.
+func startTerminalControls() {
+	if !isTerminal(os.Stdin) {
+		return
+	}
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return
+	}
+	restoreTerminalMu.Lock()
+	restoreTerminalFn = restore
+	restoreTerminalMu.Unlock()
+
+	sendTerminalAction(func(ui *terminalUI) { ui.controls = true })
+	go func() {
+		defer restoreTerminalOnPanic()
+		buf := make([]byte, 1)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			if n == 1 {
+				handleKey(buf[0])
+			}
+		}
+	}()
+}
+
+func handleKey(key byte) {
+	switch key {
+	case 'r':
+		ServerState.RecordEvent("reload", "Reload triggered from the terminal")
+		go func() {
+			defer restoreTerminalOnPanic()
+			forceReload()
+		}()
+	case 'p':
+		togglePause()
+	case 'c':
+		ServerState.ResetCounters()
+		ServerState.RecordEvent("clear", "Counters cleared")
+	case 'l':
+		sendTerminalAction(func(ui *terminalUI) { ui.showLog = !ui.showLog })
+	case '?', 'h':
+		sendTerminalAction(func(ui *terminalUI) { ui.showHelp = !ui.showHelp })
+	case 'q':
+		stopServer()
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTerminalUIRender(t *testing.T) {
+	colors := Clr
+	Clr = Colors{}
+	defer func() { Clr = colors }()
+
+	var out bytes.Buffer
+	ui := &terminalUI{out: &out, state: State{
+		ServePath:  "index.html",
+		ServeFsDir: ".",
+		Urls:       []string{"http://127.0.0.1:4774"},
+		StartedAt:  time.Now(),
+		NoRequests: 3,
+		Events: []Event{
+			{Seq: 1, Kind: "request", Message: "GET / 200", Attrs: []slog.Attr{slog.Int("status", 200)}},
+			{Seq: 2, Kind: "request", Message: "GET /app.js 404", Attrs: []slog.Attr{slog.Int("status", 404)}},
+			{Seq: 3, Kind: "warning", Message: "index.html:3: <img src> \"logo.png\" not found"},
+		},
+	}}
+	ui.render()
+	rendered := out.String()
+	for _, expected := range []string{"GET /app.js 404", "logo.png", "dotdev serving index.html from . on", "    http://127.0.0.1:4774", "Requests: 3, Updates: 0"} {
+		if !strings.Contains(rendered, expected) {
+			t.Fatalf("Expected the output to contain %q, got %q", expected, rendered)
+		}
+	}
+	if strings.Contains(rendered, "GET / 200") {
+		t.Fatalf("Expected successful requests to be hidden without the log, got %q", rendered)
+	}
+	if strings.HasPrefix(rendered, "\033[") {
+		t.Fatalf("Expected the first render not to move the cursor, got %q", rendered)
+	}
+
+	out.Reset()
+	ui.showLog = true
+	ui.showHelp = true
+	ui.state.Paused = true
+	ui.state.Events = append(ui.state.Events, Event{Seq: 4, Kind: "change", Message: "style.css"})
+	ui.render()
+	rendered = out.String()
+	if !strings.HasPrefix(rendered, "\033[6A\r\033[J") {
+		t.Fatalf("Expected the previous status block of 6 lines to be cleared, got %q", rendered)
+	}
+	if strings.Count(rendered, "GET /app.js 404") != 0 || !strings.Contains(rendered, "change     style.css") {
+		t.Fatalf("Expected only new events to be printed, got %q", rendered)
+	}
+	for _, expected := range []string{"Reloads paused, press p to resume", "KEYS:", "l  Toggle the event log"} {
+		if !strings.Contains(rendered, expected) {
+			t.Fatalf("Expected the output to contain %q, got %q", expected, rendered)
+		}
+	}
+}
+
+func TestHandleKey(t *testing.T) {
+	ui := &terminalUI{}
+	for _, key := range []byte{'l', '?'} {
+		handleKey(key)
+		select {
+		case action := <-terminalActions:
+			action(ui)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected key %q to send an action", key)
+		}
+	}
+	if !ui.showLog || !ui.showHelp {
+		t.Fatalf("Expected l and ? to show the log and the help, got %+v", ui)
+	}
+
+	paused := ServerState.Snapshot().Paused
+	handleKey('p')
+	if ServerState.Snapshot().Paused == paused {
+		t.Fatalf("Expected p to toggle pausing reloads")
+	}
+	handleKey('p')
+
+	ServerState.IncErrors()
+	total := ServerState.Snapshot().TotalErrors
+	handleKey('c')
+	if errors := ServerState.Snapshot().NoErrors; errors != 0 {
+		t.Fatalf("Expected c to clear the counters, got %d errors", errors)
+	}
+	if errors := ServerState.Snapshot().TotalErrors; errors != total {
+		t.Fatalf("Expected c to keep the total of %d errors, got %d", total, errors)
+	}
+}
+
+func TestHandleKeyAfterMonitorExit(t *testing.T) {
+	done := make(chan struct{})
+	close(done)
+	terminalMonitorMu.Lock()
+	terminalMonitorDone = done
+	terminalMonitorMu.Unlock()
+	defer func() {
+		terminalMonitorMu.Lock()
+		terminalMonitorDone = nil
+		terminalMonitorMu.Unlock()
+		for len(terminalActions) > 0 {
+			<-terminalActions
+		}
+	}()
+
+	returned := make(chan struct{})
+	go func() {
+		for i := 0; i < cap(terminalActions)+2; i++ {
+			handleKey('l')
+		}
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected key presses not to block once the monitor exited")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -8,28 +9,28 @@ import (
 // TestThrottleNoTrailing verifies that if no extra calls occur during the throttle interval,
 // only the immediate call is executed.
 func TestThrottleNoTrailing(t *testing.T) {
-	var counter int
+	var counter atomic.Int32
 	fn := func() {
-		counter++
+		counter.Add(1)
 	}
 	interval := 100 * time.Millisecond
 	throttled := Throttle(fn, interval)
 	throttled() // counter == 1
-	if counter != 1 {
-		t.Errorf("expected counter to be 1, got %d", counter)
+	if counter.Load() != 1 {
+		t.Errorf("expected counter to be 1, got %d", counter.Load())
 	}
 	time.Sleep(150 * time.Millisecond)
-	if counter != 1 {
-		t.Errorf("expected counter to be 1, got %d", counter)
+	if counter.Load() != 1 {
+		t.Errorf("expected counter to be 1, got %d", counter.Load())
 	}
 }
 
 // TestThrottleWithTrailing verifies that if calls occur during the throttle interval,
 // a trailing call is executed after the interval.
 func TestThrottleWithTrailing(t *testing.T) {
-	var counter int
+	var counter atomic.Int32
 	fn := func() {
-		counter++
+		counter.Add(1)
 	}
 	interval := 100 * time.Millisecond
 	throttled := Throttle(fn, interval)
@@ -39,21 +40,21 @@ func TestThrottleWithTrailing(t *testing.T) {
 	throttled()
 	throttled()
 
-	if counter != 1 {
-		t.Errorf("expected counter to be 2 (immediate + trailing), got %d", counter)
+	if counter.Load() != 1 {
+		t.Errorf("expected counter to be 2 (immediate + trailing), got %d", counter.Load())
 	}
 	time.Sleep(150 * time.Millisecond)
-	if counter != 2 {
-		t.Errorf("expected counter to be 2 (immediate + trailing), got %d", counter)
+	if counter.Load() != 2 {
+		t.Errorf("expected counter to be 2 (immediate + trailing), got %d", counter.Load())
 	}
 }
 
 // TestThrottleMultipleTrailing simulates continuous calls so that each throttle interval
 // should produce a trailing call.
 func TestThrottleMultipleTrailing(t *testing.T) {
-	var counter int
+	var counter atomic.Int32
 	fn := func() {
-		counter++
+		counter.Add(1)
 	}
 	interval := 100 * time.Millisecond
 	throttled := Throttle(fn, interval)
@@ -69,17 +70,17 @@ func TestThrottleMultipleTrailing(t *testing.T) {
 	time.Sleep(350 * time.Millisecond)
 
 	// Expect at least one trailing call, possibly more.
-	if counter < 2 {
-		t.Errorf("expected at least 2 calls, got %d", counter)
+	if counter.Load() < 2 {
+		t.Errorf("expected at least 2 calls, got %d", counter.Load())
 	}
 }
 
 // TestThrottleReset verifies that once the throttle interval has passed without extra calls,
 // a new call executes immediately.
 func TestThrottleReset(t *testing.T) {
-	var counter int
+	var counter atomic.Int32
 	fn := func() {
-		counter++
+		counter.Add(1)
 	}
 	interval := 100 * time.Millisecond
 	throttled := Throttle(fn, interval)
@@ -89,7 +90,7 @@ func TestThrottleReset(t *testing.T) {
 	time.Sleep(250 * time.Millisecond)
 	throttled() // counter == 3
 
-	if counter != 3 {
-		t.Errorf("expected counter to be 3, got %d", counter)
+	if counter.Load() != 3 {
+		t.Errorf("expected counter to be 3, got %d", counter.Load())
 	}
 }
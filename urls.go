@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// httpURL formats the URL of a host and port, with brackets around IPv6 addresses.
+func httpURL(host string, port int) string {
+	return "http://" + net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(port))
+}
+
+// isWildcardHost reports whether binding the host listens on all interfaces.
+func isWildcardHost(host string) bool {
+	if host == "" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsUnspecified()
+}
+
+// serverURLs returns the URLs the server is reachable at, the first one being
+// the one to open locally. When bound to all interfaces, these are the
+// loopback URL followed by the LAN URLs of the machine.
+func serverURLs(host string, port int) (urls []string, lanURLs []string) {
+	if !isWildcardHost(host) {
+		return []string{httpURL(host, port)}, nil
+	}
+	for _, ip := range lanAddresses() {
+		lanURLs = append(lanURLs, httpURL(ip.String(), port))
+	}
+	return append([]string{httpURL(DEFAULT_HOST, port)}, lanURLs...), lanURLs
+}
+
+// lanAddresses returns the addresses of the interfaces that are up, IPv4
+// first. Loopback and link-local addresses are left out, the latter need a
+// zone that browsers do not accept in URLs.
+func lanAddresses() []net.IP {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var v4, v6 []net.IP
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			var ip net.IP
+			switch a := addr.(type) {
+			case *net.IPNet:
+				ip = a.IP
+			case *net.IPAddr:
+				ip = a.IP
+			}
+			if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+				continue
+			}
+			if ip.To4() != nil {
+				v4 = append(v4, ip)
+			} else {
+				v6 = append(v6, ip)
+			}
+		}
+	}
+	return append(v4, v6...)
+}
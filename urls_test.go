@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHttpURL(t *testing.T) {
+	tests := map[string]string{
+		"127.0.0.1":   "http://127.0.0.1:4774",
+		"localhost":   "http://localhost:4774",
+		"::1":         "http://[::1]:4774",
+		"[::1]":       "http://[::1]:4774",
+		"fd00::1:2:3": "http://[fd00::1:2:3]:4774",
+	}
+	for host, want := range tests {
+		if got := httpURL(host, 4774); got != want {
+			t.Fatalf("Expected %s for host %s, got %s", want, host, got)
+		}
+	}
+}
+
+func TestServerURLs(t *testing.T) {
+	urls, lanURLs := serverURLs("localhost", 4774)
+	if len(urls) != 1 || urls[0] != "http://localhost:4774" || lanURLs != nil {
+		t.Fatalf("Expected only the host URL, got %v %v", urls, lanURLs)
+	}
+	for _, host := range []string{"0.0.0.0", "::", ""} {
+		urls, lanURLs := serverURLs(host, 4774)
+		if urls[0] != "http://127.0.0.1:4774" || len(urls) != len(lanURLs)+1 {
+			t.Fatalf("Expected loopback URL followed by the LAN URLs for %q, got %v", host, urls)
+		}
+		for _, url := range lanURLs {
+			if strings.Contains(url, "127.0.0.1") || strings.Contains(url, "[fe80:") {
+				t.Fatalf("Expected no loopback or link-local LAN URLs, got %s", url)
+			}
+		}
+	}
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"path/filepath"
 	"strings"
@@ -14,26 +15,39 @@ import (
 
 // watchFileInotify watches the given file for modifications using inotify,
 // and if the file is moved, deleted, or its attributes change, it waits for
-// the file to be recreated by watching the parent directory.
-func watchFileInotify(filename string, callback func()) {
+// the file to be recreated by watching the parent directory. It stops when the
+// context is canceled.
+func watchFileInotify(ctx context.Context, filename string, callback func()) {
 	fd, err := syscall.InotifyInit()
 	if err != nil {
 		log.Println("Error initializing inotify:", err)
 		return
 	}
-	defer syscall.Close(fd)
+	// Closing the descriptor unblocks the pending read once the context is canceled.
+	stop := context.AfterFunc(ctx, func() { syscall.Close(fd) })
+	defer func() {
+		if stop() {
+			syscall.Close(fd)
+		}
+	}()
 
 	// Flags to watch for: modifications and events that invalidate the watch.
 	flags := uint32(syscall.IN_MODIFY | syscall.IN_MOVE_SELF | syscall.IN_ATTRIB | syscall.IN_DELETE_SELF)
 	wd, err := syscall.InotifyAddWatch(fd, filename, flags)
 	if err != nil {
-		log.Println("Error adding inotify watch on file:", err)
+		// A missing file is left to the poll watcher.
+		if err != syscall.ENOENT {
+			log.Println("Error adding inotify watch on file:", err)
+		}
 		return
 	}
 
 	var buf [4096]byte
 	for {
 		n, err := syscall.Read(fd, buf[:])
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
 			log.Println("Error reading inotify events:", err)
 			continue
@@ -65,6 +79,9 @@ func watchFileInotify(filename string, callback func()) {
 				// Wait until we see a creation event for our file.
 				for !fileRecreated {
 					n, err := syscall.Read(fd, buf[:])
+					if ctx.Err() != nil {
+						return
+					}
 					if err != nil {
 						log.Println("Error reading inotify events on directory:", err)
 						continue
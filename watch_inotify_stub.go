@@ -3,9 +3,12 @@
 
 package main
 
-import "log"
+import (
+	"context"
+	"log"
+)
 
 // watchFileInotify is a stub for non-Linux platforms.
-func watchFileInotify(_ string, _ func()) {
+func watchFileInotify(_ context.Context, _ string, _ func()) {
 	log.Println("watchFileInotify is not supported on this platform")
 }
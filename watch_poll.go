@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"time"
 )
 
-// watchFile polls the given file for changes and broadcasts a reload message when modified.
-func watchFilePoll(filename string, callback func()) {
+// watchFilePoll polls the given file for changes and calls the callback when
+// it is modified or created, until the context is canceled.
+func watchFilePoll(ctx context.Context, filename string, callback func()) {
 	var lastModTime time.Time
+	if info, err := os.Stat(filename); err == nil {
+		lastModTime = info.ModTime()
+	}
 	for {
 		info, err := os.Stat(filename)
 		if err != nil {
-			log.Println("Error stating file:", err)
+			// A missing file is watched until it is created.
+			if !os.IsNotExist(err) {
+				log.Println("Error stating file:", err)
+			}
 		} else {
 			modTime := info.ModTime()
 			if modTime.After(lastModTime) {
@@ -20,6 +28,10 @@ func watchFilePoll(filename string, callback func()) {
 				callback()
 			}
 		}
-		time.Sleep(500 * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
 	}
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// WatchedFile describes a file watched for changes.
+type WatchedFile struct {
+	Path       string
+	WatchedAt  time.Time
+	LastChange time.Time
+	Changes    int
+}
+
+// watchRegistry keeps track of the watched files, so a file referenced more
+// than once is only watched once, and notifies its subscribers of changes.
+type watchRegistry struct {
+	mu          sync.Mutex
+	files       map[string]*WatchedFile
+	subscribers map[chan struct{}]struct{}
+}
+
+var watchedFiles = &watchRegistry{files: map[string]*WatchedFile{}, subscribers: map[chan struct{}]struct{}{}}
+
+// Add registers a file and reports whether it was not watched yet.
+func (reg *watchRegistry) Add(path string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if _, ok := reg.files[path]; ok {
+		return false
+	}
+	reg.files[path] = &WatchedFile{Path: path, WatchedAt: time.Now()}
+	return true
+}
+
+// Changed records a change of a watched file.
+func (reg *watchRegistry) Changed(path string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if f, ok := reg.files[path]; ok {
+		f.LastChange = time.Now()
+		f.Changes++
+	}
+	for ch := range reg.subscribers {
+		// A pending signal already covers this change.
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel signaled after watched files change, until
+// the returned function is called. Changes happening before the subscriber
+// receives the signal are coalesced into it.
+func (reg *watchRegistry) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	reg.mu.Lock()
+	reg.subscribers[ch] = struct{}{}
+	reg.mu.Unlock()
+	unsubscribe := func() {
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+		delete(reg.subscribers, ch)
+	}
+	return ch, unsubscribe
+}
+
+// List returns the watched files sorted by path.
+func (reg *watchRegistry) List() []WatchedFile {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	files := make([]WatchedFile, 0, len(reg.files))
+	for _, f := range reg.files {
+		files = append(files, *f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// Count returns the number of watched files.
+func (reg *watchRegistry) Count() int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return len(reg.files)
+}
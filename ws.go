@@ -1,19 +1,51 @@
 package main
 
 import (
+	"bufio"
 	"crypto/sha1"
 	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 )
 
+// wsClient is a connected WebSocket client, either a page with the live reload
+// snippet or the dashboard.
+type wsClient struct {
+	conn        net.Conn
+	remoteAddr  string
+	userAgent   string
+	page        string
+	connectedAt time.Time
+	dashboard   bool
+	// closing is set once the server sent a close frame. It is guarded by
+	// wsMutex.
+	closing bool
+}
+
 var (
-	wsClients = make([]net.Conn, 0)
+	wsClients = make([]*wsClient, 0)
 	wsMutex   sync.Mutex
 )
 
+// countPageClients returns the number of connected pages, not counting
+// dashboards. The caller must hold wsMutex.
+func countPageClients() int {
+	n := 0
+	for _, c := range wsClients {
+		if !c.dashboard {
+			n++
+		}
+	}
+	return n
+}
+
 // wsHandler handles the WebSocket handshake and upgrades the connection.
 func wsHandler(w http.ResponseWriter, r *http.Request) {
 	if strings.ToLower(r.Header.Get("Upgrade")) != "websocket" {
@@ -25,6 +57,12 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
 		return
 	}
+	// The dashboard shows the served paths and requests, which other sites
+	// must not read.
+	if r.URL.Query().Get("dashboard") != "" && !isSameOrigin(r) {
+		http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+		return
+	}
 	acceptKey := computeAcceptKey(key)
 
 	h := w.Header()
@@ -44,24 +82,57 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	client := &wsClient{
+		conn:        conn,
+		remoteAddr:  r.RemoteAddr,
+		userAgent:   r.UserAgent(),
+		page:        r.URL.Query().Get("page"),
+		connectedAt: time.Now(),
+		dashboard:   r.URL.Query().Get("dashboard") != "",
+	}
 	wsMutex.Lock()
-	wsClients = append(wsClients, conn)
+	wsClients = append(wsClients, client)
+	ServerState.SetConnectedClients(countPageClients())
+	if warnings := currentWarnings(); len(warnings) > 0 && !client.dashboard && showsCheckedFile(client.page) {
+		sendWarnings(client, warnings)
+	}
 	wsMutex.Unlock()
-
-	ServerState.ConnectedClients = len(wsClients)
-	notifyServerStateUpdate()
+	if client.dashboard {
+		startDashboardUpdates()
+	} else {
+		ServerState.RecordEvent("connect", fmt.Sprintf("Client connected from %s to %s", r.RemoteAddr, client.page),
+			slog.String("remote", r.RemoteAddr),
+			slog.String("page", client.page),
+			slog.String("userAgent", client.userAgent),
+		)
+	}
 
 	go func() {
-		buf := make([]byte, 1024)
+		defer restoreTerminalOnPanic()
+		r := bufio.NewReader(conn)
 		for {
-			_, err := conn.Read(buf)
+			opcode, err := readFrame(r)
+			if err == nil && opcode == wsOpcodeClose {
+				// The client answered or initiated the closing handshake.
+				wsMutex.Lock()
+				if !client.closing {
+					client.closing = true
+					sendClose(conn, wsCloseNormal, "")
+				}
+				wsMutex.Unlock()
+				err = io.EOF
+			}
 			if err != nil {
 				wsMutex.Lock()
 				for i, c := range wsClients {
-					if c == conn {
+					if c == client {
 						wsClients = append(wsClients[:i], wsClients[i+1:]...)
-						ServerState.ConnectedClients = len(wsClients)
-						notifyServerStateUpdate()
+						ServerState.SetConnectedClients(countPageClients())
+						if !client.dashboard {
+							ServerState.RecordEvent("disconnect", fmt.Sprintf("Client disconnected from %s", client.remoteAddr),
+								slog.String("remote", client.remoteAddr),
+							)
+						}
 						break
 					}
 				}
@@ -81,6 +152,42 @@ func computeAcceptKey(key string) string {
 	return base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
 
+// wsOpcodeClose is the opcode of a close frame.
+const wsOpcodeClose = 0x8
+
+// readFrame reads a WebSocket frame sent by a client and returns its opcode.
+// Clients only send control frames and the payload is discarded.
+func readFrame(r *bufio.Reader) (byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+	opcode := header[0] & 0x0F
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if header[1]&0x80 != 0 {
+		// The masking key precedes the payload of frames sent by clients.
+		length += 4
+	}
+	if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+		return 0, err
+	}
+	return opcode, nil
+}
+
 // sendReload sends a minimal WebSocket text frame with the "reload" command.
 func sendPayload(conn net.Conn, payload []byte) error {
 	frame := []byte{0x81} // 0x81 means FIN set and opcode 0x1 (text)
@@ -102,3 +209,13 @@ func sendPayload(conn net.Conn, payload []byte) error {
 	_, err := conn.Write(frame)
 	return err
 }
+
+// sendClose sends a WebSocket close frame with a status code and a reason.
+func sendClose(conn net.Conn, code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	// 0x88 means FIN set and opcode 0x8 (close); control frames are shorter than 126 bytes.
+	frame := append([]byte{0x88, byte(len(payload))}, payload...)
+	_, err := conn.Write(frame)
+	return err
+}